@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jkimbo/gh-diff/diff"
+	"github.com/spf13/cobra"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up gh-diff in the current repo",
+	Long: `Set up gh-diff in the current repo.
+
+Creates the .diff directory with the database and config and installs the
+commit-msg hook that adds a Diff-Id trailer to every commit.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := diff.NewClient()
+		err := c.Init(ctx)
+		check(err)
+	},
+}
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Show the interactive dashboard",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.Dashboard(ctx)
+		check(err)
+	},
+}
+
+var syncOpts diff.SyncOptions
+
+// syncStacking is set by the --stack, --no-stack and --auto flags of sync
+var syncStacking struct {
+	stack, noStack, auto bool
+}
+
+// stackingPolicy returns the stacking policy chosen with the sync flags or an
+// empty string to use the config
+func stackingPolicy() (string, error) {
+	var policies []string
+	if syncStacking.stack {
+		policies = append(policies, diff.StackingStack)
+	}
+	if syncStacking.noStack {
+		policies = append(policies, diff.StackingNoStack)
+	}
+	if syncStacking.auto {
+		policies = append(policies, diff.StackingAuto)
+	}
+	if len(policies) > 1 {
+		return "", fmt.Errorf("only one of --stack, --no-stack and --auto can be used")
+	}
+	if len(policies) == 0 {
+		return "", nil
+	}
+	return policies[0], nil
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync <diff>",
+	Short: "Push a diff and create or update its PR",
+	Long: `Push a diff to its branch and create or update its PR.
+
+Any diffs that are stacked on the diff are synced as well so that they are
+rebased onto the new version.
+
+A new diff can be stacked on someone else's PR with --onto. It's based on
+that PR's branch until the PR merges and then it's retargeted to the default
+branch.
+
+When a new diff's parent commit is a synced diff sync asks whether to stack
+on it. --stack, --no-stack and --auto (stack if the parent has been synced)
+answer without asking, as does setting stacking in .diff/config.yaml. Without
+a terminal sync fails instead of asking.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		stacking, err := stackingPolicy()
+		check(err)
+		syncOpts.Stacking = stacking
+
+		c := setupClient(ctx)
+		err = c.SyncDiff(ctx, args[0], syncOpts)
+		check(err)
+	},
+}
+
+var landCmd = &cobra.Command{
+	Use:   "land <diff>",
+	Short: "Merge a diff's PR and sync its dependant diffs",
+	Long: `Squash merge a diff's PR into the default branch.
+
+The diffs that are stacked on it are retargeted to the default branch and
+synced. A diff can't be landed while the diff or PR it's stacked on is open.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.LandDiff(ctx, args[0])
+		check(err)
+	},
+}
+
+var abandonCmd = &cobra.Command{
+	Use:   "abandon <diff>",
+	Short: "Close a diff's PR and delete its branch",
+	Long: `Close a diff's PR and delete its branch.
+
+Any diff stacked on it is restacked onto the abandoned diff's parent. The
+commit itself is left in the local branch.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.AbandonDiff(ctx, args[0])
+		check(err)
+	},
+}
+
+var interdiffCmd = &cobra.Command{
+	Use:               "interdiff <diff>",
+	Short:             "Show what has changed since a diff was last synced",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.Interdiff(ctx, args[0])
+		check(err)
+	},
+}
+
+var revisionsCmd = &cobra.Command{
+	Use:               "revisions <diff>",
+	Short:             "List every revision of a diff that has been synced",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.Revisions(ctx, args[0])
+		check(err)
+	},
+}
+
+var revdiffCmd = &cobra.Command{
+	Use:   "revdiff <diff> <from> [<to>]",
+	Short: "Compare two revisions of a diff",
+	Long: `Compare two revisions of a diff.
+
+If <to> isn't given the revision is compared with the local commit.`,
+	Args: cobra.RangeArgs(2, 3),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return completeDiffs(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		var to string
+		if len(args) > 2 {
+			to = args[2]
+		}
+		err := c.RevisionDiff(ctx, args[0], args[1], to)
+		check(err)
+	},
+}
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Run the git hooks installed by init",
+}
+
+var commitMsgHookCmd = &cobra.Command{
+	Use:   "commit-msg <file>",
+	Short: "Add a Diff-Id trailer to a commit message",
+	Long: `Add a Diff-Id trailer to a commit message file if it doesn't already have one.
+
+This is run by the commit-msg hook that "gh diff init" installs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		err := diff.CommitMsgHook(ctx, args[0])
+		check(err)
+	},
+}
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [<range>]",
+	Short: "Add Diff-Id trailers to commits that don't have one",
+	Long: `Add a Diff-Id trailer to every commit that doesn't have one so that it can be synced.
+
+<range> can be a range of commits or a single commit and defaults to the
+commits between the default branch and HEAD. The commits are rewritten with a
+rebase so any uncommitted changes are stashed first.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		var revRange string
+		if len(args) > 0 {
+			revRange = args[0]
+		}
+		err := c.AdoptCommits(ctx, revRange)
+		check(err)
+	},
+}
+
+var reidKeep string
+
+var reidCmd = &cobra.Command{
+	Use:   "reid <commit>",
+	Short: "Give a commit a new Diff-Id",
+	Long: `Replace the Diff-Id trailers of a commit with a single new Diff-Id.
+
+Use this when a commit has been copied (e.g. cherry-picked) so that two commits
+share a Diff-Id, or when a commit has more than one Diff-Id trailer. Use --keep
+to keep one of the commit's existing Diff-Ids instead of generating a new one.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.ReIDCommit(ctx, args[0], reidKeep)
+		check(err)
+	},
+}
+
+var splitOpts diff.SplitOptions
+
+var splitCmd = &cobra.Command{
+	Use:   "split <diff>",
+	Short: "Split a diff into several diffs",
+	Long: `Split a diff into several diffs by choosing which of its hunks go into each one.
+
+Each part becomes a new commit with a new Diff-Id, stacked in order where the
+diff was. One part keeps the diff's Diff-Id so that it keeps its branch and PR.
+Use --files to split by file instead of by hunk.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.SplitDiff(ctx, args[0], splitOpts)
+		check(err)
+	},
+}
+
+var foldCmd = &cobra.Command{
+	Use:   "fold <diff>",
+	Short: "Squash a diff into the diff below it",
+	Long: `Squash a diff into the diff below it in the stack.
+
+The diff below keeps its Diff-Id, branch and PR. The folded diff's PR is closed
+with a comment pointing to the surviving PR, its branch is deleted and any diffs
+stacked on it are restacked onto the surviving diff.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.FoldDiff(ctx, args[0])
+		check(err)
+	},
+}
+
+var reorderCmd = &cobra.Command{
+	Use:   "reorder [<diff>...]",
+	Short: "Reorder the diffs in the current branch",
+	Long: `Reorder the commits between the default branch and HEAD.
+
+Give every commit in its new order, oldest first, or leave out the arguments to
+edit the order in your editor. The commits are rebased (and the rebase is
+aborted if there are any conflicts), diffs that are part of a stack are
+restacked to match the new order, PRs are retargeted onto their new base
+branch and the branches of the diffs that moved are synced.`,
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.ReorderDiffs(ctx, args)
+		check(err)
+	},
+}
+
+var amendCmd = &cobra.Command{
+	Use:   "amend <diff>",
+	Short: "Commit the staged changes into a diff",
+	Long: `Commit the staged changes into a diff anywhere in the stack.
+
+The changes are committed as a fixup commit and squashed into the diff's commit
+with a rebase. If they conflict with the commits on top of the diff the rebase
+is aborted and the changes are left staged. The diff and every diff that
+depends on it are then synced.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.AmendDiff(ctx, args[0])
+		check(err)
+	},
+}
+
+var checkoutEdit bool
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout <diff>",
+	Short: "Move to the commit of a diff",
+	Long: `Move to the commit of a diff.
+
+HEAD is detached at the diff's commit, or the branch is checked out if the diff
+is at the top of it. Diffs can still be found by their Diff-Id while HEAD is
+detached. Use --edit to start a rebase that stops at the diff instead, so that
+it can be amended before the diffs on top of it are rebased.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDiffs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.CheckoutDiff(ctx, args[0], checkoutEdit)
+		check(err)
+	},
+}
+
+var nextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Check out the diff stacked on the current diff",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.NextDiff(ctx)
+		check(err)
+	},
+}
+
+var prevCmd = &cobra.Command{
+	Use:   "prev",
+	Short: "Check out the diff that the current diff is stacked on",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.PrevDiff(ctx)
+		check(err)
+	},
+}
+
+var fetchOpts diff.FetchOptions
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch <PR number>",
+	Short: "Fetch a stack of PRs created by someone else",
+	Long: `Fetch the stack of PRs that a PR is part of so that it can be reviewed, taken
+over or stacked on.
+
+The PR's base branches are followed down to the default branch, and the PRs
+based on its branch are followed up, to find the whole stack. Each PR becomes a
+single commit with a Diff-Id in a new local branch (stack-<number> unless
+--branch is given) and is recorded as a diff.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.FetchStack(ctx, args[0], fetchOpts)
+		check(err)
+	},
+}
+
+var listOpts diff.ListOptions
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"status"},
+	Short:   "List the diffs in the current branch",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
+		err := c.ListDiffs(ctx, listOpts)
+		check(err)
+	},
+}
+
+// completeDiffs completes the commits, Diff-Ids and branches of the diffs in
+// the current branch
+func completeDiffs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	ctx := context.Background()
+	c := diff.NewClient()
+	if err := c.Setup(ctx); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	completions, err := c.CompleteDiffs(ctx, toComplete)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	rootCmd.PersistentFlags().Bool("debug", false, "Panic with a stack trace on errors")
+
+	syncCmd.Flags().BoolVar(&syncOpts.SkipDependants, "no-dependants", false, "Don't sync the diffs stacked on this diff")
+	syncCmd.Flags().StringVar(&syncOpts.Onto, "onto", "", "Stack a new diff on a branch or PR (#123) that isn't a local diff")
+	syncCmd.Flags().BoolVar(&syncStacking.stack, "stack", false, "Stack a new diff on its parent diff without asking")
+	syncCmd.Flags().BoolVar(&syncStacking.noStack, "no-stack", false, "Base a new diff on the default branch without asking")
+	syncCmd.Flags().BoolVar(&syncStacking.auto, "auto", false, "Stack a new diff on its parent diff if it has been synced, without asking")
+
+	reidCmd.Flags().StringVar(&reidKeep, "keep", "", "Keep this `Diff-Id` instead of generating a new one")
+
+	checkoutCmd.Flags().BoolVarP(&checkoutEdit, "edit", "e", false, "Start a rebase that stops at the diff so it can be amended")
+
+	fetchCmd.Flags().StringVarP(&fetchOpts.Branch, "branch", "b", "", "Name of the local `branch` to create")
+
+	splitCmd.Flags().BoolVar(&splitOpts.Files, "files", false, "Split by file instead of by hunk")
+
+	listCmd.Flags().BoolVar(&listOpts.JSON, "json", false, "Output JSON")
+	listCmd.Flags().StringVarP(&listOpts.Template, "template", "t", "", "Format JSON output using a Go template")
+	listCmd.Flags().StringVarP(&listOpts.JQ, "jq", "q", "", "Filter JSON output using a jq expression")
+
+	hookCmd.AddCommand(commitMsgHookCmd)
+
+	rootCmd.AddCommand(
+		initCmd,
+		hookCmd,
+		dashboardCmd,
+		syncCmd,
+		landCmd,
+		abandonCmd,
+		adoptCmd,
+		reidCmd,
+		splitCmd,
+		foldCmd,
+		reorderCmd,
+		amendCmd,
+		checkoutCmd,
+		nextCmd,
+		prevCmd,
+		fetchCmd,
+		interdiffCmd,
+		revisionsCmd,
+		revdiffCmd,
+		listCmd,
+	)
+}
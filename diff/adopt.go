@@ -0,0 +1,176 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// AdoptCommits adds a Diff-Id trailer to every commit in a range that doesn't
+// have one, so that commits made before the commit-msg hook was installed can
+// be synced. The range defaults to the commits between the default branch and
+// HEAD and can also be a single commit. The commits are rewritten with a
+// rebase.
+func (c *Diffclient) AdoptCommits(ctx context.Context, revRange string) error {
+	if revRange == "" {
+		revRange = fmt.Sprintf("origin/%s..HEAD", c.config.DefaultBranch)
+	}
+
+	var revListArgs []string
+	if strings.Contains(revRange, "..") {
+		revListArgs = []string{"rev-list", "--reverse", revRange}
+	} else {
+		revListArgs = []string{"rev-list", "-n", "1", revRange}
+	}
+	commits, err := runCommand(exec.Command("git", revListArgs...), true, false)
+	if err != nil {
+		return fmt.Errorf("invalid range: %s", revRange)
+	}
+
+	var untracked []string
+	for _, commit := range strings.Split(commits, "\n") {
+		if commit == "" {
+			continue
+		}
+		ids, err := diffIDsFromCommit(commit)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			continue
+		}
+		// Only commits in the current branch can be rewritten
+		_, err = runCommand(
+			exec.Command("git", "merge-base", "--is-ancestor", commit, "HEAD"),
+			true,
+			false,
+		)
+		if err != nil {
+			return fmt.Errorf("commit %.7s isn't in the current branch", commit)
+		}
+		untracked = append(untracked, commit)
+	}
+
+	if len(untracked) == 0 {
+		fmt.Println("every commit already has a Diff-Id")
+		return nil
+	}
+
+	ids := map[string]string{}
+	used := map[string]bool{}
+	for _, commit := range untracked {
+		var id string
+		// The ids aren't in any commits until the rebase has finished so make
+		// sure that they are unique amongst themselves too
+		for id == "" || used[id] {
+			id, err = c.newDiffID(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		used[id] = true
+		ids[commit] = id
+	}
+
+	base, rebaseCommits, err := rebaseRange(untracked[0])
+	if err != nil {
+		return err
+	}
+	todo := []string{}
+	for _, commit := range rebaseCommits {
+		todo = append(todo, fmt.Sprintf("pick %s", commit))
+		if id, ok := ids[commit]; ok {
+			todo = append(todo, setDiffIDExec(id))
+		}
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		return err
+	}
+
+	for _, commit := range untracked {
+		d := &diff{commit: commit}
+		fmt.Printf("%.7s %s → Diff-Id: %s\n", commit, d.getSubject(), ids[commit])
+	}
+	fmt.Printf("adopted %d commits\n", len(untracked))
+
+	return nil
+}
+
+// rebaseRange returns the commits from oldest up to HEAD, oldest first, and
+// the base that they need to be rebased onto. The base is empty if oldest is
+// the root commit.
+func rebaseRange(oldest string) (string, []string, error) {
+	if err := checkCanRewrite(); err != nil {
+		return "", nil, err
+	}
+
+	base := fmt.Sprintf("%s^", oldest)
+	commitRange := fmt.Sprintf("%s..HEAD", base)
+	if _, err := runCommand(exec.Command("git", "rev-parse", "--verify", "--quiet", base), true, false); err != nil {
+		base = ""
+		commitRange = "HEAD"
+	}
+
+	merges := mustCommand(
+		exec.Command("git", "rev-list", "--merges", commitRange),
+		true,
+		false,
+	)
+	if merges != "" {
+		return "", nil, fmt.Errorf("can't rewrite commits across a merge commit")
+	}
+
+	output := mustCommand(
+		exec.Command("git", "rev-list", "--reverse", commitRange),
+		true,
+		false,
+	)
+	commits := []string{}
+	for _, commit := range strings.Split(output, "\n") {
+		if commit != "" {
+			commits = append(commits, commit)
+		}
+	}
+
+	return base, commits, nil
+}
+
+// runRebase runs an interactive rebase onto base (or from the root commit if
+// base is empty) with the todo list. The rebase is aborted if anything fails.
+func runRebase(base string, todo []string) error {
+	rebaseArgs := []string{"rebase", "-i", "--autostash", "--keep-empty"}
+	if base == "" {
+		rebaseArgs = append(rebaseArgs, "--root")
+	} else {
+		rebaseArgs = append(rebaseArgs, base)
+	}
+
+	todoFile, err := os.CreateTemp("", "gh-diff-todo-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(todoFile.Name())
+	_, err = todoFile.WriteString(strings.Join(todo, "\n") + "\n")
+	todoFile.Close()
+	if err != nil {
+		return err
+	}
+
+	// git opens the sequence editor with the path of its todo list so
+	// replace it with ours
+	rebaseCmd := exec.Command("git", rebaseArgs...)
+	rebaseCmd.Env = append(
+		os.Environ(),
+		fmt.Sprintf("GIT_SEQUENCE_EDITOR=cp '%s'", todoFile.Name()),
+	)
+	_, err = runCommand(rebaseCmd, true, false)
+	if err != nil {
+		runCommand(exec.Command("git", "rebase", "--abort"), true, false)
+		return fmt.Errorf("rebase failed and has been aborted: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AmendDiff commits the staged changes into a diff's commit, wherever it is
+// in the stack, and then syncs the diff and every diff that depends on it.
+// The staged changes are committed as a fixup commit that is squashed into
+// the diff with a rebase.
+func (c *Diffclient) AmendDiff(ctx context.Context, ref string) error {
+	if err := checkCanRewrite(); err != nil {
+		return err
+	}
+
+	d, err := c.resolveDiff(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	// git diff --quiet exits with 1 if there are changes
+	_, err = exec.Command("git", "diff", "--cached", "--quiet").Output()
+	if err == nil {
+		return fmt.Errorf("there are no staged changes to amend %s with", d.id)
+	}
+
+	fmt.Printf("amending diff: %s (%s)\n", d.getSubject(), d.id)
+
+	_, err = runCommand(
+		exec.Command("git", "commit", "--no-verify", fmt.Sprintf("--fixup=%s", d.commit)),
+		true,
+		false,
+	)
+	if err != nil {
+		return err
+	}
+	fixup := mustCommand(exec.Command("git", "rev-parse", "HEAD"), true, false)
+
+	base, rebaseCommits, err := rebaseRange(d.commit)
+	if err != nil {
+		undoFixup()
+		return err
+	}
+	todo := []string{}
+	for _, commit := range rebaseCommits {
+		switch commit {
+		case fixup:
+			continue
+		case d.commit:
+			todo = append(todo, fmt.Sprintf("pick %s", commit))
+			todo = append(todo, fmt.Sprintf("fixup %s", fixup))
+		default:
+			todo = append(todo, fmt.Sprintf("pick %s", commit))
+		}
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		undoFixup()
+		return fmt.Errorf(
+			"the changes conflict with the commits on top of %s so nothing has been amended and they are still staged\n%v",
+			d.id, err,
+		)
+	}
+
+	fmt.Printf("amended %s\n", d.id)
+
+	if d.isSaved() == false {
+		return nil
+	}
+
+	// Reload the diff now that its commit has changed
+	d, err = newDiffFromID(ctx, d.id)
+	if err != nil {
+		return err
+	}
+	dependantDiffs, err := d.getDependantDiffs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, syncDiff := range append([]*diff{d}, dependantDiffs...) {
+		if syncDiff.commit == "" {
+			continue
+		}
+		fmt.Printf("syncing diff: %s (%s)\n", syncDiff.getSubject(), syncDiff.id)
+		err = syncDiff.Sync(ctx)
+		if err != nil {
+			fmt.Printf("unable to sync %s: %v\n", syncDiff.id, err)
+			failed = append(failed, syncDiff.id)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"%d of %d diffs couldn't be synced: %s",
+			len(failed), len(dependantDiffs)+1, strings.Join(failed, ", "),
+		)
+	}
+
+	return nil
+}
+
+// undoFixup removes the fixup commit at HEAD, leaving its changes staged
+func undoFixup() {
+	mustCommand(exec.Command("git", "reset", "--soft", "HEAD^"), true, false)
+}
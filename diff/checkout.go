@@ -0,0 +1,237 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// checkoutBranchFile is the file in the git dir that remembers the branch
+// that a diff was checked out from while HEAD is detached
+const checkoutBranchFile = "gh-diff-branch"
+
+// branchTip returns the ref of the branch that the diffs are in. It's HEAD
+// unless HEAD has been detached by checking out a diff, in which case it's
+// the branch that the diff was checked out from.
+func branchTip() string {
+	if _, err := exec.Command("git", "symbolic-ref", "-q", "HEAD").Output(); err == nil {
+		return "HEAD"
+	}
+	branch := checkedOutFrom()
+	if branch == "" {
+		return "HEAD"
+	}
+	return fmt.Sprintf("refs/heads/%s", branch)
+}
+
+// checkedOutFrom returns the branch that the current diff was checked out
+// from, or an empty string if there isn't one
+func checkedOutFrom() string {
+	path, err := exec.Command("git", "rev-parse", "--git-path", checkoutBranchFile).Output()
+	if err != nil {
+		return ""
+	}
+	contents, err := os.ReadFile(strings.TrimSpace(string(path)))
+	if err != nil {
+		return ""
+	}
+	branch := strings.TrimSpace(string(contents))
+	if branchExists(branch) == false {
+		return ""
+	}
+	return branch
+}
+
+// branchExists returns true if there is a local branch with the name
+func branchExists(branch string) bool {
+	_, err := exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branch)).Output()
+	return err == nil
+}
+
+// rebaseInProgress returns true if git is in the middle of a rebase
+func rebaseInProgress() bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := exec.Command("git", "rev-parse", "--git-path", dir).Output()
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSpace(string(path))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCanRewrite returns an error if commits can't be rewritten because a
+// rebase is in progress or HEAD has been detached by checking out a diff. A
+// rebase would only rewrite the detached HEAD and leave the branch that the
+// diffs are found in unchanged.
+func checkCanRewrite() error {
+	if rebaseInProgress() {
+		return fmt.Errorf("a rebase is in progress, finish it with \"git rebase --continue\" first")
+	}
+	if branchTip() != "HEAD" {
+		return fmt.Errorf(
+			"HEAD is detached from %s, run \"git switch %s\" before rewriting commits",
+			checkedOutFrom(), checkedOutFrom(),
+		)
+	}
+	return nil
+}
+
+// CheckoutDiff moves to the commit of a diff. By default HEAD is detached at
+// the commit (or the branch is checked out if the diff is at the top of it).
+// With edit an interactive rebase is started that stops at the commit so
+// that it can be amended before the rest of the stack is rebased on top.
+func (c *Diffclient) CheckoutDiff(ctx context.Context, ref string, edit bool) error {
+	if rebaseInProgress() {
+		return fmt.Errorf("a rebase is in progress, finish it with \"git rebase --continue\" first")
+	}
+
+	commit, err := c.resolveCommit(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if edit {
+		return c.editCommit(commit)
+	}
+	return c.checkoutCommit(commit)
+}
+
+// NextDiff checks out the diff stacked on top of the current diff
+func (c *Diffclient) NextDiff(ctx context.Context) error {
+	return c.moveInStack(ctx, func(d *diff) (*diff, string, error) {
+		child, err := d.childDiff(ctx)
+		return child, "top", err
+	})
+}
+
+// PrevDiff checks out the diff that the current diff is stacked on
+func (c *Diffclient) PrevDiff(ctx context.Context) error {
+	return c.moveInStack(ctx, func(d *diff) (*diff, string, error) {
+		parent, err := d.parentDiff(ctx)
+		return parent, "bottom", err
+	})
+}
+
+// moveInStack checks out the diff that next returns for the diff at HEAD,
+// following the stacked_on links in the db
+func (c *Diffclient) moveInStack(ctx context.Context, next func(d *diff) (*diff, string, error)) error {
+	if rebaseInProgress() {
+		return fmt.Errorf("a rebase is in progress, finish it with \"git rebase --continue\" first")
+	}
+
+	head := mustCommand(exec.Command("git", "rev-parse", "HEAD"), true, false)
+	id, err := diffIDFromCommit(head)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("HEAD (%.7s) isn't a diff", head)
+	}
+	d, err := newDiffFromID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if d.isSaved() == false {
+		return fmt.Errorf("diff %s hasn't been synced so it isn't in a stack", d.id)
+	}
+
+	target, end, err := next(d)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return fmt.Errorf("diff %s is at the %s of its stack", d.id, end)
+	}
+	if target.commit == "" {
+		return fmt.Errorf("diff %s isn't in the current branch", target.id)
+	}
+
+	return c.checkoutCommit(target.commit)
+}
+
+// checkoutCommit detaches HEAD at a commit in the branch, remembering the
+// branch so that diffs can still be found. The branch itself is checked out
+// instead if the commit is at the top of it.
+func (c *Diffclient) checkoutCommit(commit string) error {
+	branch := mustCommand(exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD"), true, false)
+	if branch == "HEAD" {
+		branch = checkedOutFrom()
+	}
+
+	if branch != "" {
+		tip := mustCommand(exec.Command("git", "rev-parse", fmt.Sprintf("refs/heads/%s", branch)), true, false)
+		if tip == commit {
+			_, err := runCommand(exec.Command("git", "switch", branch), true, false)
+			if err != nil {
+				return err
+			}
+			c.printCheckedOut(commit, fmt.Sprintf("on %s", branch))
+			return nil
+		}
+
+		path := mustCommand(exec.Command("git", "rev-parse", "--git-path", checkoutBranchFile), true, false)
+		err := os.WriteFile(path, []byte(branch+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := runCommand(exec.Command("git", "switch", "--detach", commit), true, false)
+	if err != nil {
+		return err
+	}
+	c.printCheckedOut(commit, "detached")
+	if branch != "" {
+		fmt.Printf("run \"git switch %s\" to go back to the branch\n", branch)
+	}
+
+	return nil
+}
+
+func (c *Diffclient) printCheckedOut(commit, where string) {
+	d := &diff{commit: commit}
+	id, _ := diffIDFromCommit(commit)
+	if id == "" {
+		id = fmt.Sprintf("%.7s", commit)
+	}
+	fmt.Printf("checked out [%s] %s (%s)\n", id, d.getSubject(), where)
+}
+
+// editCommit starts a rebase that stops at commit so that it can be edited
+func (c *Diffclient) editCommit(commit string) error {
+	// The rebase has to run on the branch so that it's updated when the
+	// rebase finishes
+	if branch := checkedOutFrom(); branch != "" && branchTip() != "HEAD" {
+		_, err := runCommand(exec.Command("git", "switch", branch), true, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	base, rebaseCommits, err := rebaseRange(commit)
+	if err != nil {
+		return err
+	}
+	todo := []string{}
+	for _, rebaseCommit := range rebaseCommits {
+		if rebaseCommit == commit {
+			todo = append(todo, fmt.Sprintf("edit %s", rebaseCommit))
+		} else {
+			todo = append(todo, fmt.Sprintf("pick %s", rebaseCommit))
+		}
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		return err
+	}
+
+	c.printCheckedOut(commit, "editing")
+	fmt.Println("make your changes and run \"git commit --amend\", then \"git rebase --continue\" to restack the diffs on top")
+
+	return nil
+}
@@ -4,16 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cli/go-gh"
 	"github.com/cli/go-gh/pkg/api"
@@ -31,25 +27,67 @@ type Diffclient struct {
 
 // Setup loads the DB and config
 func (c *Diffclient) Setup(ctx context.Context) error {
-	sqlDB, err := NewDB(ctx, filepath.Join(".diff", "main.db"))
+	err := c.load(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to connect to database: %v", err)
+		return err
 	}
-	c.db = sqlDB
 
+	// Make sure that any tables added since init was run exist
+	err = c.db.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("error setting up db: %v", err)
+	}
+
+	return nil
+}
+
+// load loads the config and connects to the DB without changing it
+func (c *Diffclient) load(ctx context.Context) error {
 	config, err := loadConfig()
 	if err != nil {
 		return err
 	}
 	c.config = config
+
+	sqlDB, err := NewDB(ctx, filepath.Join(".diff", "main.db"))
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %v", err)
+	}
+	c.db = sqlDB
 	return nil
 }
 
+// SyncOptions controls what SyncDiff syncs
+type SyncOptions struct {
+	// SkipDependants only syncs the diff itself and not the diffs that are
+	// stacked on it
+	SkipDependants bool
+	// Onto stacks a new diff on a branch or PR (#123) that isn't a local diff,
+	// e.g. a teammate's PR
+	Onto string
+	// Stacking overrides the stacking policy in the config for a new diff
+	// whose parent commit is a synced diff
+	Stacking string
+}
+
 // SyncDiff syncs a diff (and it's dependant diffs) to the remote
-func (c *Diffclient) SyncDiff(ctx context.Context, commit string) error {
-	d, err := newDiffFromCommit(ctx, commit)
+func (c *Diffclient) SyncDiff(ctx context.Context, ref string, opts SyncOptions) error {
+	d, err := c.resolveDiff(ctx, ref)
 	check(err)
 
+	d.stacking = opts.Stacking
+
+	if opts.Onto != "" {
+		if d.isSaved() {
+			return fmt.Errorf("diff %s has already been synced, --onto only applies to new diffs", d.id)
+		}
+		d.externalBranch, d.externalPRNumber, err = resolveExternalParent(opts.Onto)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("stacking on %s\n", d.externalParentName())
+	}
+
 	fmt.Printf("syncing diff: %s (%s)\n", d.getSubject(), d.id)
 
 	err = d.Sync(ctx)
@@ -71,7 +109,9 @@ func (c *Diffclient) SyncDiff(ctx context.Context, commit string) error {
 	dependantDiffs, err := d.getDependantDiffs(ctx)
 	check(err)
 
-	if len(dependantDiffs) > 0 {
+	if len(dependantDiffs) > 0 && opts.SkipDependants {
+		fmt.Printf("skipping %d dependant diffs\n", len(dependantDiffs))
+	} else if len(dependantDiffs) > 0 {
 		fmt.Printf("%d dependant diffs to sync\n", len(dependantDiffs))
 
 		for _, dependantDiff := range dependantDiffs {
@@ -145,25 +185,9 @@ func (c *Diffclient) Init(ctx context.Context) error {
 	)
 
 	// Setup git commit hook
-	commitMsgHookPath := filepath.Join(rootPath, ".git", "hooks", "commit-msg")
-	if _, err := os.Stat(commitMsgHookPath); err != nil {
-		resp, err := http.Get("https://raw.githubusercontent.com/jkimbo/gh-diff/main/hooks/commit-msg")
-		if err != nil {
-			log.Fatalf("err downloading hook: %s", err)
-		}
-		defer resp.Body.Close()
-
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		err = ioutil.WriteFile(commitMsgHookPath, bodyBytes, 0755)
-		if err != nil {
-			log.Fatalf("err writing hook: %s", err)
-		}
-	} else {
-		fmt.Println("commit-msg hook already exists. skipping")
+	err = installCommitMsgHook()
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -171,8 +195,8 @@ func (c *Diffclient) Init(ctx context.Context) error {
 
 // LandDiff merges the PR for a diff into main branch and syncs all dependant
 // diffs
-func (c *Diffclient) LandDiff(ctx context.Context, commit string) error {
-	d, err := newDiffFromCommit(ctx, commit)
+func (c *Diffclient) LandDiff(ctx context.Context, ref string) error {
+	d, err := c.resolveDiff(ctx, ref)
 	check(err)
 
 	// Make sure that diff is not dependant on another diff that hasn't landed
@@ -184,13 +208,26 @@ func (c *Diffclient) LandDiff(ctx context.Context, commit string) error {
 		os.Exit(1)
 	}
 
+	// A diff stacked on a teammate's PR can only land once that PR has merged,
+	// at which point it's retargeted and rebased onto the default branch
+	if d.externalBranch != "" {
+		merged, err := d.externalParentMerged()
+		check(err)
+		if merged == false {
+			fmt.Printf("Diff is stacked on %s that hasn't merged yet\n", d.externalParentName())
+			os.Exit(1)
+		}
+		err = d.Sync(ctx)
+		check(err)
+	}
+
 	if d.prNumber == "" {
 		fmt.Printf("Diff %s doesn't have a PR number\n", d.id)
 		os.Exit(1)
 		return nil
 	}
 
-	fmt.Printf("Landing commit: %s", commit)
+	fmt.Printf("Landing commit: %s", d.commit)
 
 	// Merge PR
 	_, _, err = ghCommand(
@@ -199,6 +236,21 @@ func (c *Diffclient) LandDiff(ctx context.Context, commit string) error {
 		},
 	)
 
+	// Base the PRs of dependant diffs on the default branch, otherwise landing
+	// them would merge them into the landed diff's branch
+	children, err := c.db.getChildDiffs(ctx, d.id)
+	check(err)
+	for _, child := range children {
+		if child.PRNumber != "" {
+			fmt.Printf("retargeting PR #%s onto %s\n", child.PRNumber, c.config.DefaultBranch)
+			mustCommand(
+				exec.Command("gh", "pr", "edit", child.PRNumber, "--base", c.config.DefaultBranch),
+				true,
+				false,
+			)
+		}
+	}
+
 	mustCommand(
 		exec.Command(
 			"git", "pull", "origin", c.config.DefaultBranch, "--rebase",
@@ -232,83 +284,236 @@ func (c *Diffclient) LandDiff(ctx context.Context, commit string) error {
 	return nil
 }
 
-func (c *Diffclient) Dashboard(ctx context.Context) (string, tui.DashboardAction, error) {
-	repoURL := mustCommand(
-		exec.Command("gh", "repo", "view", "--json=url", "--jq=.url"),
+// AbandonDiff closes the PR for a diff, deletes its branch and removes it from
+// its stack. The commit itself is left untouched.
+func (c *Diffclient) AbandonDiff(ctx context.Context, ref string) error {
+	d, err := c.resolveDiff(ctx, ref)
+	check(err)
+
+	if d.isSaved() == false {
+		return fmt.Errorf("diff %s hasn't been synced so there is nothing to abandon", d.id)
+	}
+
+	// Dependant diffs get stacked on the abandoned diff's parent instead
+	newBaseRef := c.config.DefaultBranch
+	parent, err := d.parentDiff(ctx)
+	check(err)
+	if parent != nil && parent.commit != "" {
+		newBaseRef = parent.branch
+	}
+	if d.externalBranch != "" {
+		newBaseRef = d.externalBranch
+	}
+
+	children, err := c.restackChildren(
+		ctx, d, d.parentDiffID, d.externalBranch, d.externalPRNumber, newBaseRef,
+	)
+	check(err)
+
+	err = c.deleteDiff(ctx, d, "")
+	check(err)
+
+	err = c.syncRestacked(ctx, children)
+	check(err)
+
+	return nil
+}
+
+// restackChildren stacks the diffs that are stacked on d onto parentID
+// instead, or onto an external branch if externalBranch is set, and retargets
+// their PRs onto baseRef. It returns the ids of the restacked diffs.
+func (c *Diffclient) restackChildren(
+	ctx context.Context,
+	d *diff,
+	parentID, externalBranch, externalPRNumber, baseRef string,
+) ([]string, error) {
+	children, err := c.db.getChildDiffs(ctx, d.id)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, child := range children {
+		fmt.Printf("restacking %s onto %s\n", child.ID, baseRef)
+		err = c.db.updateStackedOn(ctx, child.ID, parentID)
+		if err != nil {
+			return nil, err
+		}
+		err = c.db.updateExternalParent(ctx, child.ID, externalBranch, externalPRNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		// Retarget the PR before the branch is deleted otherwise GitHub
+		// closes it
+		if child.PRNumber != "" {
+			mustCommand(
+				exec.Command("gh", "pr", "edit", child.PRNumber, "--base", baseRef),
+				true,
+				false,
+			)
+		}
+		ids = append(ids, child.ID)
+	}
+
+	return ids, nil
+}
+
+// deleteDiff closes the PR of a diff, with a comment if one is given, and
+// deletes its branch and its row in the db. Anything stacked on it needs to
+// be restacked first.
+func (c *Diffclient) deleteDiff(ctx context.Context, d *diff, comment string) error {
+	if d.prNumber != "" {
+		fmt.Printf("closing PR #%s\n", d.prNumber)
+		args := []string{"pr", "close", d.prNumber}
+		if comment != "" {
+			args = append(args, "--comment", comment)
+		}
+		mustCommand(exec.Command("gh", args...), true, false)
+	}
+
+	fmt.Printf("deleting branch %s\n", d.branch)
+	// Note: we don't care if these fail because the branch might not exist
+	runCommand(
+		exec.Command("git", "push", "origin", "--delete", d.branch),
 		true,
 		false,
 	)
-
-	// get all commits from HEAD to defaultBranch
-	commits := mustCommand(
-		exec.Command(
-			"git",
-			"rev-list",
-			fmt.Sprintf("origin/%s...HEAD", client.config.DefaultBranch),
-		),
+	runCommand(
+		exec.Command("git", "branch", "-D", d.branch),
 		true,
 		false,
 	)
-	lines := strings.Split(commits, "\n")
 
-	items := []list.Item{}
-
-	for _, commit := range lines {
-		id := diffIDFromCommit(commit)
-		if id == "" {
-			// TODO
-		} else {
-			d, err := newDiffFromCommit(ctx, commit)
-			check(err)
+	return c.db.removeDiff(ctx, d.id)
+}
 
-			var isStacked bool
-			var needsSyncing bool
-			isSaved := d.branch != ""
-
-			if isSaved {
-				parentDiff, err := d.parentDiff(ctx)
-				check(err)
-				if parentDiff != nil && parentDiff.commit != "" {
-					isStacked = true
-				}
-
-				needsSyncing, err = d.needsSyncing(ctx)
-				check(err)
-			}
-
-			item := tui.Item{
-				ID:           d.id,
-				Commit:       d.commit,
-				Title:        d.getSubject(),
-				IsStacked:    isStacked,
-				IsSaved:      isSaved,
-				NeedsSyncing: needsSyncing,
-			}
-			if d.prNumber != "" {
-				item.PrLink = fmt.Sprintf("%s/pull/%s", repoURL, d.prNumber)
-			}
-			items = append(items, item)
+// syncRestacked syncs diffs that have been restacked, and the diffs stacked
+// on them. A diff that is in another branch can only be synced from there.
+func (c *Diffclient) syncRestacked(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		d, err := newDiffFromID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if d.commit == "" {
+			fmt.Printf("%s isn't in the current branch, run \"gh diff sync %s\" from its branch\n", id, id)
+			continue
 		}
+		err = c.SyncDiff(ctx, id, SyncOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Interdiff prints what has changed in a diff since it was last synced
+func (c *Diffclient) Interdiff(ctx context.Context, ref string) error {
+	d, err := c.resolveDiff(ctx, ref)
+	check(err)
+
+	if d.isSaved() == false {
+		return fmt.Errorf("diff %s hasn't been synced yet", d.id)
+	}
+
+	i, err := d.getInterdiff()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s)\n\n", d.getSubject(), d.id)
+	for _, line := range i.summary() {
+		fmt.Println(line)
+	}
+	if i.rangeDiff != "" {
+		fmt.Printf("\n%s\n", i.rangeDiff)
 	}
 
-	p := tea.NewProgram(tui.NewModel(items))
+	return nil
+}
 
-	m, err := p.StartReturningModel()
+// Revisions lists every version of a diff that has been synced
+func (c *Diffclient) Revisions(ctx context.Context, ref string) error {
+	d, err := c.resolveDiff(ctx, ref)
+	check(err)
+
+	revisions, err := c.db.getRevisions(ctx, d.id)
 	if err != nil {
-		fmt.Println("Error running program:", err)
-		os.Exit(1)
+		return err
+	}
+
+	if len(revisions) == 0 {
+		fmt.Printf("diff %s hasn't been synced yet\n", d.id)
+		return nil
+	}
+
+	fmt.Printf("%s (%s)\n\n", d.getSubject(), d.id)
+	for _, revision := range revisions {
+		fmt.Printf(
+			"#%d  %.7s  %s  base: %.7s\n",
+			revision.Number,
+			revision.Commit,
+			revision.CreatedAt.Local().Format("2006-01-02 15:04"),
+			revision.Base,
+		)
+	}
+
+	return nil
+}
+
+// RevisionDiff shows what changed in a diff between two revisions. If "to" is
+// empty the local commit is used.
+func (c *Diffclient) RevisionDiff(ctx context.Context, ref, from, to string) error {
+	d, err := c.resolveDiff(ctx, ref)
+	check(err)
+
+	fromNumber, err := parseRevisionNumber(from)
+	if err != nil {
+		return err
+	}
+	fromCommit, err := d.getRevisionCommit(ctx, fromNumber)
+	if err != nil {
+		return err
 	}
 
-	if m, ok := m.(tui.Model); ok {
-		choice := m.GetChoice()
-		i, ok := choice.(tui.Item)
-		if !ok {
-			return "", 0, nil
+	toCommit := d.commit
+	if to != "" {
+		toNumber, err := parseRevisionNumber(to)
+		if err != nil {
+			return err
 		}
-		return i.Commit, m.GetAction(), nil
+		toCommit, err = d.getRevisionCommit(ctx, toNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	rangeDiff, err := d.git.getRangeDiff(fromCommit, toCommit)
+	if err != nil {
+		return err
+	}
+	fmt.Println(rangeDiff)
+
+	return nil
+}
+
+// Dashboard shows the interactive dashboard
+func (c *Diffclient) Dashboard(ctx context.Context) error {
+	backend := newDashboardBackend(ctx)
+
+	model, err := tui.NewModel(backend, c.config.refreshInterval(), c.config.tui())
+	if err != nil {
+		return err
 	}
 
-	return "", 0, nil
+	p := tea.NewProgram(model)
+
+	if err := p.Start(); err != nil {
+		return fmt.Errorf("error running program: %v", err)
+	}
+
+	return nil
 }
 
 // NewClient creates a new diff client
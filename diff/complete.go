@@ -0,0 +1,54 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CompleteDiffs returns the commits, Diff-Ids and branches of the diffs in the
+// current branch that start with toComplete for shell completion. Each
+// completion is followed by a tab and a description.
+func (c *Diffclient) CompleteDiffs(ctx context.Context, toComplete string) ([]string, error) {
+	commits, err := exec.Command(
+		"git",
+		"log",
+		"--format=%h%x09%s",
+		fmt.Sprintf("origin/%s..%s", c.config.DefaultBranch, branchTip()),
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	completions := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(commits)), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		sha, subject := parts[0], parts[1]
+		candidates := []string{sha}
+
+		if id, _ := diffIDFromCommit(sha); id != "" {
+			subject = fmt.Sprintf("[%s] %s", id, subject)
+			candidates = append(candidates, id)
+
+			instance, err := c.db.getDiff(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if instance != nil && instance.Branch != "" {
+				candidates = append(candidates, instance.Branch)
+			}
+		}
+
+		for _, candidate := range candidates {
+			if strings.HasPrefix(candidate, toComplete) {
+				completions = append(completions, fmt.Sprintf("%s\t%s", candidate, subject))
+			}
+		}
+	}
+
+	return completions, nil
+}
@@ -1,15 +1,37 @@
 package diff
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
+	"github.com/jkimbo/gh-diff/tui"
 	"gopkg.in/yaml.v3"
 )
 
 type config struct {
-	DefaultBranch string `yaml:"default_branch"`
+	DefaultBranch   string         `yaml:"default_branch"`
+	RefreshInterval *time.Duration `yaml:"refresh_interval,omitempty"`
+	// RevisionComments posts a comment on the PR summarising what changed
+	// every time a diff is re-synced
+	RevisionComments bool `yaml:"revision_comments,omitempty"`
+	// Stacking is what sync does when a new diff's parent commit is a synced
+	// diff: ask, auto, stack or no-stack. It defaults to ask.
+	Stacking string `yaml:"stacking,omitempty"`
+	// TUI customises the keys and colors of the dashboard
+	TUI tui.Config `yaml:"tui,omitempty"`
+
+	user *userConfig
+}
+
+// userConfig is the config in the user's config directory. Only the tui
+// section is used so that the dashboard can be customised across repos.
+type userConfig struct {
+	TUI tui.Config `yaml:"tui,omitempty"`
 }
 
 func initConfig(rootPath string) *config {
@@ -42,5 +64,100 @@ func loadConfig() (*config, error) {
 		return nil, err
 	}
 
+	if config.Stacking != "" && !validStacking(config.Stacking) {
+		return nil, fmt.Errorf(
+			"invalid stacking in config.yaml: %s (expected %s, %s, %s or %s)",
+			config.Stacking, StackingAsk, StackingAuto, StackingStack, StackingNoStack,
+		)
+	}
+
+	config.user, err = loadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// defaultRefreshInterval is how often the dashboard reloads if
+// refresh_interval isn't set in the config
+const defaultRefreshInterval = time.Minute
+
+// refreshInterval returns how often the dashboard should reload. Setting
+// refresh_interval to 0 disables auto refresh.
+func (c *config) refreshInterval() time.Duration {
+	if c.RefreshInterval == nil {
+		return defaultRefreshInterval
+	}
+	return *c.RefreshInterval
+}
+
+// Stacking policies decide whether a new diff is stacked on its parent commit
+// when that commit is a synced diff
+const (
+	// StackingAsk asks every time, which needs a terminal
+	StackingAsk = "ask"
+	// StackingAuto stacks on the parent if it has been synced and bases the
+	// diff on the default branch otherwise
+	StackingAuto = "auto"
+	// StackingStack always stacks on the parent and fails if it hasn't been
+	// synced
+	StackingStack = "stack"
+	// StackingNoStack always bases the diff on the default branch
+	StackingNoStack = "no-stack"
+)
+
+func validStacking(stacking string) bool {
+	switch stacking {
+	case StackingAsk, StackingAuto, StackingStack, StackingNoStack:
+		return true
+	}
+	return false
+}
+
+// stacking returns the stacking policy to use when none is given to sync
+func (c *config) stacking() string {
+	if c.Stacking == "" {
+		return StackingAsk
+	}
+	return c.Stacking
+}
+
+// userConfigPath is where the user level config lives, usually
+// ~/.config/gh-diff/config.yaml
+func userConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gh-diff", "config.yaml"), nil
+}
+
+func loadUserConfig() (*userConfig, error) {
+	config := &userConfig{}
+	path, err := userConfigPath()
+	if err != nil {
+		return config, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	d := yaml.NewDecoder(file)
+	if err := d.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// tui returns the dashboard config. Settings in the repo config override the
+// user level config.
+func (c *config) tui() tui.Config {
+	return c.user.TUI.Merge(c.TUI)
+}
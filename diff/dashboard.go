@@ -0,0 +1,373 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/jkimbo/gh-diff/tui"
+)
+
+// dashboardBackend loads the dashboard items and runs actions in the
+// background
+type dashboardBackend struct {
+	ctx         context.Context
+	repoURL     string
+	repoURLErr  error
+	repoURLOnce sync.Once
+}
+
+func newDashboardBackend(ctx context.Context) *dashboardBackend {
+	return &dashboardBackend{
+		ctx: ctx,
+	}
+}
+
+func (b *dashboardBackend) getRepoURL() (string, error) {
+	b.repoURLOnce.Do(func() {
+		b.repoURL, b.repoURLErr = commandOutput(
+			exec.Command("gh", "repo", "view", "--json=url", "--jq=.url"),
+		)
+	})
+	return b.repoURL, b.repoURLErr
+}
+
+// LoadItems returns an item for every diff between HEAD and the default branch
+func (b *dashboardBackend) LoadItems() ([]tui.Item, error) {
+	repoURL, err := b.getRepoURL()
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits that share a Diff-Id can't be told apart
+	index, err := client.getDiffIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDiffIndex(index); err != nil {
+		return nil, err
+	}
+
+	// get all commits from HEAD to defaultBranch along with their authors
+	commits, err := commandOutput(
+		exec.Command(
+			"git",
+			"log",
+			"--format=%H%x09%an",
+			fmt.Sprintf("origin/%s..%s", client.config.DefaultBranch, branchTip()),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []tui.Item{}
+	inBranch := map[string]bool{}
+	for _, line := range strings.Split(commits, "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 2)
+		commit, author := parts[0], parts[len(parts)-1]
+
+		id, err := diffIDFromCommit(commit)
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			// Commits without a Diff-Id are shown so that it's clear where
+			// they are but can't be acted on
+			title, err := commitField(commit, "%s")
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, tui.Item{
+				Commit: commit,
+				Title:  title,
+				Author: author,
+			})
+			continue
+		}
+
+		d, err := newDiffFromCommit(b.ctx, commit)
+		if err != nil {
+			return nil, err
+		}
+		title, err := commitField(commit, "%s")
+		if err != nil {
+			return nil, err
+		}
+
+		item := tui.Item{
+			ID:        d.id,
+			Commit:    d.commit,
+			Title:     title,
+			Author:    author,
+			Branch:    d.branch,
+			IsSaved:   d.isSaved(),
+			StackedOn: d.parentDiffID,
+		}
+		if d.externalBranch != "" {
+			item.StackedOnExternal = d.externalParentName()
+		}
+		if d.prNumber != "" {
+			item.PrNumber = d.prNumber
+			item.PrLink = fmt.Sprintf("%s/pull/%s", repoURL, d.prNumber)
+		}
+		items = append(items, item)
+		inBranch[d.id] = true
+	}
+
+	// Include the diffs that local diffs are stacked on but that are no longer
+	// in the local branch (usually because they have landed) so that the stack
+	// graph is complete. Landed diffs are added to the end of items so that
+	// the diffs they are stacked on are included too.
+	for idx := 0; idx < len(items); idx++ {
+		item := items[idx]
+		if item.StackedOn == "" || inBranch[item.StackedOn] {
+			continue
+		}
+		inBranch[item.StackedOn] = true
+
+		instance, err := client.db.getDiff(b.ctx, item.StackedOn)
+		if err != nil {
+			return nil, err
+		}
+		if instance == nil {
+			continue
+		}
+
+		landed := tui.Item{
+			ID:        instance.ID,
+			Branch:    instance.Branch,
+			StackedOn: instance.StackedOn,
+			IsSaved:   true,
+			IsLanded:  true,
+		}
+		if instance.PRNumber != "" {
+			landed.PrNumber = instance.PRNumber
+			landed.PrLink = fmt.Sprintf("%s/pull/%s", repoURL, instance.PRNumber)
+		}
+		items = append(items, landed)
+	}
+
+	return items, nil
+}
+
+// LoadItem works out if the diff is stacked and if it needs syncing
+func (b *dashboardBackend) LoadItem(item tui.Item) (tui.Item, error) {
+	if item.IsSaved == false {
+		return item, nil
+	}
+
+	d, err := newDiffFromCommit(b.ctx, item.Commit)
+	if err != nil {
+		return item, err
+	}
+
+	parentDiff, err := d.parentDiff(b.ctx)
+	if err != nil {
+		return item, err
+	}
+	item.IsStacked = parentDiff != nil && parentDiff.commit != ""
+
+	i, err := d.getInterdiff()
+	if err != nil {
+		return item, err
+	}
+	item.NeedsSyncing = i.changed()
+	item.SyncReason = i.reason()
+
+	return item, nil
+}
+
+// LoadPrStatuses fetches the status of every item's PR in a single request
+func (b *dashboardBackend) LoadPrStatuses(items []tui.Item) (map[string]tui.Item, error) {
+	prNumbers := []string{}
+	for _, item := range items {
+		if item.PrNumber != "" {
+			prNumbers = append(prNumbers, item.PrNumber)
+		}
+	}
+
+	statuses, err := getPRStatuses(prNumbers)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch PR statuses: %v", err)
+	}
+
+	result := map[string]tui.Item{}
+	for _, item := range items {
+		if item.Commit == "" {
+			continue
+		}
+		if status, ok := statuses[item.PrNumber]; ok {
+			setItemPRStatus(&item, status)
+			result[item.Commit] = item
+		}
+	}
+
+	return result, nil
+}
+
+// LoadDetail loads the commit message, patch and PR comments of a diff
+func (b *dashboardBackend) LoadDetail(item tui.Item) (tui.Detail, error) {
+	g := &gitcmd{}
+	d := &diff{
+		id:     item.ID,
+		commit: item.Commit,
+		branch: item.Branch,
+		git:    g,
+	}
+	base := fmt.Sprintf("%s^", item.Commit)
+
+	detail := tui.Detail{}
+	var err error
+	detail.Body, err = commitField(item.Commit, "%b")
+	if err != nil {
+		return detail, err
+	}
+	detail.Stat, err = g.getDiffStat(item.Commit, base)
+	if err != nil {
+		return detail, err
+	}
+	detail.Patch, err = g.getPatch(item.Commit, base)
+	if err != nil {
+		return detail, err
+	}
+
+	if item.NeedsSyncing && item.Branch != "" {
+		i, err := d.getInterdiff()
+		if err != nil {
+			return detail, err
+		}
+		detail.Interdiff = toTUIInterdiff(i)
+	}
+
+	if item.PrNumber != "" {
+		reviews, comments, err := getPRComments(item.PrNumber)
+		if err != nil {
+			return detail, fmt.Errorf("unable to fetch PR comments: %v", err)
+		}
+		detail.Reviews = toTUIComments(reviews)
+		detail.Comments = toTUIComments(comments)
+	}
+
+	return detail, nil
+}
+
+// LoadInterdiff compares the local commit of a diff with its pushed branch
+func (b *dashboardBackend) LoadInterdiff(item tui.Item) (tui.Interdiff, error) {
+	if item.Branch == "" {
+		return tui.Interdiff{}, fmt.Errorf("diff hasn't been synced yet")
+	}
+
+	d := &diff{
+		id:     item.ID,
+		commit: item.Commit,
+		branch: item.Branch,
+		git:    &gitcmd{},
+	}
+	i, err := d.getInterdiff()
+	if err != nil {
+		return tui.Interdiff{}, err
+	}
+	return *toTUIInterdiff(i), nil
+}
+
+// ActionCommand runs the action in a separate gh-diff process so that the
+// output can be shown in the dashboard and a failure doesn't exit the
+// dashboard
+func (b *dashboardBackend) ActionCommand(action tui.DashboardAction, item tui.Item) *exec.Cmd {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+
+	var cmd *exec.Cmd
+	switch action {
+	case tui.Land:
+		cmd = exec.Command(executable, "land", item.Commit)
+	case tui.Abandon:
+		cmd = exec.Command(executable, "abandon", item.Commit)
+	case tui.Adopt:
+		cmd = exec.Command(executable, "adopt", item.Commit)
+	default:
+		// There is no terminal to prompt with so new diffs are stacked on
+		// their parent diff if it has been synced
+		cmd = exec.Command(executable, "sync", "--auto", item.Commit)
+	}
+
+	return cmd
+}
+
+// ReorderCommand reorders the commits in a separate gh-diff process like the
+// other actions
+func (b *dashboardBackend) ReorderCommand(order []string) *exec.Cmd {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+
+	return exec.Command(executable, append([]string{"reorder"}, order...)...)
+}
+
+func toTUIInterdiff(i *interdiff) *tui.Interdiff {
+	return &tui.Interdiff{
+		Summary:     i.summary(),
+		NeedsReview: i.needsReview(),
+		Diff:        i.rangeDiff,
+	}
+}
+
+func toTUIComments(comments []prComment) []tui.Comment {
+	result := make([]tui.Comment, 0, len(comments))
+	for _, c := range comments {
+		result = append(result, tui.Comment{
+			Author:    c.Author.Login,
+			State:     c.State,
+			Body:      c.Body,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+	return result
+}
+
+func setItemPRStatus(item *tui.Item, status *prStatus) {
+	item.HasPrStatus = true
+	item.PrIsDraft = status.IsDraft
+	item.PrUnresolvedThreads = status.unresolvedThreads()
+
+	switch status.ReviewDecision {
+	case "APPROVED":
+		item.PrReviewStatus = tui.Passed
+	case "CHANGES_REQUESTED":
+		item.PrReviewStatus = tui.Failed
+	case "REVIEW_REQUIRED":
+		item.PrReviewStatus = tui.Pending
+	default:
+		item.PrReviewStatus = tui.NoStatus
+	}
+
+	switch status.checksState() {
+	case "SUCCESS":
+		item.PrChecksStatus = tui.Passed
+	case "FAILURE", "ERROR":
+		item.PrChecksStatus = tui.Failed
+	case "PENDING", "EXPECTED":
+		item.PrChecksStatus = tui.Pending
+	default:
+		item.PrChecksStatus = tui.NoStatus
+	}
+
+	switch status.Mergeable {
+	case "MERGEABLE":
+		item.PrMergeStatus = tui.Passed
+	case "CONFLICTING":
+		item.PrMergeStatus = tui.Failed
+	default:
+		item.PrMergeStatus = tui.Pending
+	}
+}
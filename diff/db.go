@@ -3,6 +3,8 @@ package diff
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -14,9 +16,20 @@ const schema = `
 		id TEXT PRIMARY KEY,
 		branch TEXT,
 		pr_number TEXT,
-		stacked_on TEXT
+		stacked_on TEXT,
+		external_branch TEXT NOT NULL DEFAULT '',
+		external_pr_number TEXT NOT NULL DEFAULT ''
 	);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_diffs_id ON diffs (id);
+	CREATE TABLE IF NOT EXISTS revisions (
+		diff_id TEXT NOT NULL,
+		number INTEGER NOT NULL,
+		commit_sha TEXT,
+		patch_id TEXT,
+		base TEXT,
+		created_at TIMESTAMP,
+		PRIMARY KEY (diff_id, number)
+	);
 `
 
 // "models"
@@ -27,13 +40,33 @@ type dbdiff struct {
 	Branch    string `db:"branch"`
 	PRNumber  string `db:"pr_number"`
 	StackedOn string `db:"stacked_on"`
+	// ExternalBranch and ExternalPRNumber are set when the diff is stacked on
+	// a branch that isn't a local diff, e.g. a teammate's PR
+	ExternalBranch   string `db:"external_branch"`
+	ExternalPRNumber string `db:"external_pr_number"`
+}
+
+// Revision .
+type dbrevision struct {
+	DiffID    string    `db:"diff_id"`
+	Number    int       `db:"number"`
+	Commit    string    `db:"commit_sha"`
+	PatchID   string    `db:"patch_id"`
+	Base      string    `db:"base"`
+	CreatedAt time.Time `db:"created_at"`
 }
 
 // DB .
 type DB interface {
 	getDiff(ctx context.Context, diffID string) (*dbdiff, error)
+	getDiffByBranch(ctx context.Context, branch string) (*dbdiff, error)
+	getDiffByPrNumber(ctx context.Context, prNumber string) (*dbdiff, error)
 	createDiff(ctx context.Context, diff *dbdiff) error
 	getChildDiff(ctx context.Context, diffID string) (*dbdiff, error)
+	getChildDiffs(ctx context.Context, diffID string) ([]*dbdiff, error)
+	createRevision(ctx context.Context, revision *dbrevision) error
+	getRevisions(ctx context.Context, diffID string) ([]*dbrevision, error)
+	getRevision(ctx context.Context, diffID string, number int) (*dbrevision, error)
 }
 
 // SQLDB .
@@ -71,6 +104,38 @@ func (db *SQLDB) getDiff(ctx context.Context, diffID string) (*dbdiff, error) {
 	return &diff, nil
 }
 
+func (db *SQLDB) getDiffByBranch(ctx context.Context, branch string) (*dbdiff, error) {
+	query, args, err := db.StatementBuilder.Select("*").From("diffs").
+		Where("branch = ?", branch).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var diff dbdiff
+	if err := db.DB.Get(&diff, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &diff, nil
+}
+
+func (db *SQLDB) getDiffByPrNumber(ctx context.Context, prNumber string) (*dbdiff, error) {
+	query, args, err := db.StatementBuilder.Select("*").From("diffs").
+		Where("pr_number = ?", prNumber).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var diff dbdiff
+	if err := db.DB.Get(&diff, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &diff, nil
+}
+
 func (db *SQLDB) createDiff(ctx context.Context, diff *dbdiff) error {
 	statement := db.StatementBuilder.Insert("diffs").
 		Columns(
@@ -78,12 +143,16 @@ func (db *SQLDB) createDiff(ctx context.Context, diff *dbdiff) error {
 			"branch",
 			"pr_number",
 			"stacked_on",
+			"external_branch",
+			"external_pr_number",
 		).
 		Values(
 			diff.ID,
 			diff.Branch,
 			diff.PRNumber,
 			diff.StackedOn,
+			diff.ExternalBranch,
+			diff.ExternalPRNumber,
 		)
 
 	query, args, err := statement.ToSql()
@@ -109,6 +178,35 @@ func (db *SQLDB) updatePrNumber(ctx context.Context, diffID, prNumber string) er
 	return err
 }
 
+func (db *SQLDB) updateStackedOn(ctx context.Context, diffID, stackedOn string) error {
+	statement := db.StatementBuilder.Update("diffs").
+		Set("stacked_on", stackedOn).
+		Where("id = ?", diffID)
+
+	query, args, err := statement.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (db *SQLDB) updateExternalParent(ctx context.Context, diffID, branch, prNumber string) error {
+	statement := db.StatementBuilder.Update("diffs").
+		Set("external_branch", branch).
+		Set("external_pr_number", prNumber).
+		Where("id = ?", diffID)
+
+	query, args, err := statement.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
 func (db *SQLDB) getChildDiff(ctx context.Context, diffID string) (*dbdiff, error) {
 	query, args, err := db.StatementBuilder.Select("*").From("diffs").
 		Where("stacked_on = ?", diffID).ToSql()
@@ -125,6 +223,20 @@ func (db *SQLDB) getChildDiff(ctx context.Context, diffID string) (*dbdiff, erro
 	return &diff, nil
 }
 
+// getChildDiffs returns every diff that is stacked on a diff
+func (db *SQLDB) getChildDiffs(ctx context.Context, diffID string) ([]*dbdiff, error) {
+	query, args, err := db.StatementBuilder.Select("*").From("diffs").
+		Where("stacked_on = ?", diffID).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var diffs []*dbdiff
+	if err := db.DB.Select(&diffs, query, args...); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
 func (db *SQLDB) removeDiff(ctx context.Context, diffID string) error {
 	query, args, err := db.StatementBuilder.Delete("diffs").
 		Where("id = ?", diffID).ToSql()
@@ -135,9 +247,107 @@ func (db *SQLDB) removeDiff(ctx context.Context, diffID string) error {
 	return err
 }
 
+func (db *SQLDB) createRevision(ctx context.Context, revision *dbrevision) error {
+	statement := db.StatementBuilder.Insert("revisions").
+		Columns(
+			"diff_id",
+			"number",
+			"commit_sha",
+			"patch_id",
+			"base",
+			"created_at",
+		).
+		Values(
+			revision.DiffID,
+			revision.Number,
+			revision.Commit,
+			revision.PatchID,
+			revision.Base,
+			revision.CreatedAt,
+		)
+
+	query, args, err := statement.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// getRevisions returns all the revisions of a diff, oldest first
+func (db *SQLDB) getRevisions(ctx context.Context, diffID string) ([]*dbrevision, error) {
+	query, args, err := db.StatementBuilder.Select("*").From("revisions").
+		Where("diff_id = ?", diffID).
+		OrderBy("number").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*dbrevision
+	if err := db.DB.Select(&revisions, query, args...); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (db *SQLDB) getRevision(ctx context.Context, diffID string, number int) (*dbrevision, error) {
+	query, args, err := db.StatementBuilder.Select("*").From("revisions").
+		Where("diff_id = ? AND number = ?", diffID, number).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var revision dbrevision
+	if err := db.DB.Get(&revision, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// columns are added to tables that were created before the columns existed
+var columns = []struct {
+	table      string
+	name       string
+	definition string
+}{
+	{"diffs", "external_branch", "TEXT NOT NULL DEFAULT ''"},
+	{"diffs", "external_pr_number", "TEXT NOT NULL DEFAULT ''"},
+}
+
 // Init setups up the database schema
 func (db *SQLDB) Init(ctx context.Context) error {
 	// execute a query on the server
 	_, err := db.DB.Exec(schema)
-	return err
+	if err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		var existing []struct {
+			Name string `db:"name"`
+		}
+		err = db.DB.Select(&existing, fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", column.table))
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, c := range existing {
+			if c.Name == column.name {
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		_, err = db.DB.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition,
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
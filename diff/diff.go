@@ -4,42 +4,55 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/AlecAivazis/survey/v2/terminal"
 )
 
-func diffIDFromCommit(commit string) string {
+// diffIDFromCommit returns the Diff-Id trailer of a commit. It's an error for
+// a commit to have more than one.
+func diffIDFromCommit(commit string) (string, error) {
+	ids, err := diffIDsFromCommit(commit)
+	if err != nil {
+		return "", err
+	}
+	switch len(ids) {
+	case 0:
+		return "", nil
+	case 1:
+		return ids[0], nil
+	}
+	return "", fmt.Errorf(
+		"commit %.7s has %d Diff-Id trailers (%s)\nrun \"gh diff reid %.7s\" to give it a single Diff-Id",
+		commit, len(ids), strings.Join(ids, ", "), commit,
+	)
+}
+
+// diffIDsFromCommit returns every Diff-Id trailer of a commit
+func diffIDsFromCommit(commit string) ([]string, error) {
 	// Find diff trailer
-	trailers := mustCommand(
+	trailers, err := commandOutput(
 		exec.Command(
 			"bash",
 			"-c",
 			fmt.Sprintf("git show -s --format=%%B %s | git interpret-trailers --parse", commit),
 		),
-		true,
-		false,
 	)
+	if err != nil {
+		return nil, err
+	}
 
 	lines := strings.Split(trailers, "\n")
-	var diffID string
-	// TODO raise error if multiple diff ids found
+	ids := []string{}
 	for _, line := range lines {
 		kv := strings.Split(strings.TrimSpace(line), ":")
-		if kv[0] == "Diff-Id" {
-			diffID = strings.TrimSpace(kv[1])
-			break
-		}
-		if kv[0] == "DiffID" {
-			diffID = strings.TrimSpace(kv[1])
-			break
+		if kv[0] == "Diff-Id" || kv[0] == "DiffID" {
+			ids = append(ids, strings.TrimSpace(kv[1]))
 		}
 	}
 
-	return diffID
+	return ids, nil
 }
 
 // diff .
@@ -49,12 +62,18 @@ type diff struct {
 	branch       string
 	prNumber     string
 	parentDiffID string
-	git          *gitcmd
+	// externalBranch and externalPRNumber are the branch and PR that the diff
+	// is stacked on when it's stacked on something that isn't a local diff
+	externalBranch   string
+	externalPRNumber string
+	// stacking overrides the stacking policy in the config when the diff is
+	// synced for the first time
+	stacking string
+	git      *gitcmd
 }
 
 // Sync .
 func (d *diff) Sync(ctx context.Context) error {
-	var err error
 	commit := d.commit
 	if commit == "" {
 		return fmt.Errorf("can't find commit for diff %s", d.id)
@@ -66,6 +85,12 @@ func (d *diff) Sync(ctx context.Context) error {
 		true,
 		false,
 	)
+	switchBack := []string{"switch", currentBranch}
+	if currentBranch == "HEAD" {
+		// HEAD is detached e.g. a diff has been checked out
+		head := mustCommand(exec.Command("git", "rev-parse", "HEAD"), true, false)
+		switchBack = []string{"switch", "--detach", head}
+	}
 
 	var syncError error
 	if d.isSaved() == false {
@@ -78,75 +103,34 @@ func (d *diff) Sync(ctx context.Context) error {
 
 	// Always switch back to "currentBranch"
 	mustCommand(
-		exec.Command(
-			"git", "switch", currentBranch,
-		),
+		exec.Command("git", switchBack...),
 		true,
 		false,
 	)
 
 	if syncError != nil {
-		return err
+		return syncError
 	}
 
 	return nil
 }
 
 func (d *diff) syncNew(ctx context.Context, commit string) error {
-	baseRef := fmt.Sprintf("origin/%s", client.config.DefaultBranch)
-
 	branchName, err := d.generateBranchName()
 	if err != nil {
 		return err
 	}
 
-	var stackedOn string
-
-	// Check parent commit to see if it's also a diff
-	parentCommit, err := runCommand(
-		exec.Command(
-			"git", "rev-parse", fmt.Sprintf("%s^", commit),
-		),
-		true,
-		false,
-	)
+	var baseRef, stackedOn string
+	if d.externalBranch != "" {
+		baseRef, err = fetchExternalBranch(d.externalBranch)
+	} else {
+		baseRef, stackedOn, err = d.stackOnParent(ctx, commit)
+	}
 	if err != nil {
 		return err
 	}
 
-	parentDiffID := diffIDFromCommit(parentCommit)
-
-	if parentDiffID != "" {
-		fmt.Println("parent commit is a diff")
-		parentDiff, err := newDiffFromCommit(ctx, parentCommit)
-		if err != nil {
-			return err
-		}
-
-		// If the parent diff hasn't been saved then assume the baseRef is the
-		// default branch
-		if parentDiff.isSaved() == true {
-			stackChanges := false
-			prompt := &survey.Confirm{
-				Message: fmt.Sprintf(
-					"Stack your changes on \"[%s] %s\"?",
-					parentDiff.id, parentDiff.getSubject(),
-				),
-			}
-			err := survey.AskOne(prompt, &stackChanges)
-			if err != nil {
-				if err == terminal.InterruptErr {
-					os.Exit(1)
-				}
-				log.Fatalf("err: %s", err)
-			}
-			if stackChanges == true {
-				baseRef = parentDiff.branch
-				stackedOn = parentDiff.id
-			}
-		}
-	}
-
 	fmt.Printf("syncing %s to branch %s (base: %s)\n", commit, branchName, baseRef)
 
 	err = d.syncCommitToBranch(ctx, commit, branchName, baseRef)
@@ -156,9 +140,11 @@ func (d *diff) syncNew(ctx context.Context, commit string) error {
 
 	// Save diff
 	err = client.db.createDiff(ctx, &dbdiff{
-		ID:        d.id,
-		Branch:    branchName,
-		StackedOn: stackedOn,
+		ID:               d.id,
+		Branch:           branchName,
+		StackedOn:        stackedOn,
+		ExternalBranch:   d.externalBranch,
+		ExternalPRNumber: d.externalPRNumber,
 	})
 	if err != nil {
 		return err
@@ -170,6 +156,81 @@ func (d *diff) syncNew(ctx context.Context, commit string) error {
 	return nil
 }
 
+// stackOnParent returns the base ref for a new diff and the id of the diff
+// that it's stacked on. If the parent commit is a saved diff then the stacking
+// policy decides whether to stack on it, otherwise it's based on the default
+// branch.
+func (d *diff) stackOnParent(ctx context.Context, commit string) (baseRef, stackedOn string, err error) {
+	baseRef = fmt.Sprintf("origin/%s", client.config.DefaultBranch)
+
+	stacking := d.stacking
+	if stacking == "" {
+		stacking = client.config.stacking()
+	}
+	if stacking == StackingNoStack {
+		return baseRef, "", nil
+	}
+
+	// Check parent commit to see if it's also a diff
+	parentCommit, err := runCommand(
+		exec.Command(
+			"git", "rev-parse", fmt.Sprintf("%s^", commit),
+		),
+		true,
+		false,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	parentDiffID, err := diffIDFromCommit(parentCommit)
+	if err != nil {
+		return "", "", err
+	}
+	if parentDiffID == "" {
+		return baseRef, "", nil
+	}
+
+	fmt.Println("parent commit is a diff")
+	parentDiff, err := newDiffFromCommit(ctx, parentCommit)
+	if err != nil {
+		return "", "", err
+	}
+
+	// If the parent diff hasn't been saved then assume the baseRef is the
+	// default branch
+	if parentDiff.isSaved() == false {
+		if stacking == StackingStack {
+			return "", "", fmt.Errorf("can't stack on %s because it hasn't been synced, sync it first", parentDiff.id)
+		}
+		return baseRef, "", nil
+	}
+
+	stackChanges := stacking != StackingAsk
+	if stacking == StackingAsk {
+		if !interactive() {
+			return "", "", fmt.Errorf(
+				"can't ask whether to stack on %s without a terminal, use --stack, --no-stack or --auto or set stacking in config.yaml",
+				parentDiff.id,
+			)
+		}
+		err := askOne(&survey.Confirm{
+			Message: fmt.Sprintf(
+				"Stack your changes on \"[%s] %s\"?",
+				parentDiff.id, parentDiff.getSubject(),
+			),
+		}, &stackChanges)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if stackChanges == true {
+		return parentDiff.branch, parentDiff.id, nil
+	}
+
+	return baseRef, "", nil
+}
+
 func (d *diff) syncSaved(ctx context.Context, commit string) error {
 	baseRef := fmt.Sprintf("origin/%s", client.config.DefaultBranch)
 
@@ -182,6 +243,13 @@ func (d *diff) syncSaved(ctx context.Context, commit string) error {
 		baseRef = stackedOnDiff.branch
 	}
 
+	if d.externalBranch != "" {
+		baseRef, err = d.externalBaseRef(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = d.syncCommitToBranch(ctx, commit, d.branch, baseRef)
 	if err != nil {
 		return err
@@ -290,6 +358,8 @@ func (d *diff) syncCommitToBranch(ctx context.Context, commit, branchName, baseR
 		false,
 		false,
 	)
+
+	err = d.recordRevision(ctx, branchName, baseRef)
 	if err != nil {
 		return err
 	}
@@ -311,6 +381,9 @@ func (d *diff) createPR(ctx context.Context) error {
 	if stackedOn != nil && stackedOn.commit != "" {
 		baseRef = stackedOn.branch
 	}
+	if d.externalBranch != "" {
+		baseRef = d.externalBranch
+	}
 
 	title := d.getSubject()
 	body := d.getBody()
@@ -447,17 +520,8 @@ func (d *diff) getSubject() string {
 		panic(fmt.Errorf("can't find commit for diff %s", d.id))
 	}
 
-	subject := mustCommand(
-		exec.Command(
-			"git",
-			"show",
-			"-s",
-			"--format=%s",
-			commit,
-		),
-		true,
-		false,
-	)
+	subject, err := commitField(commit, "%s")
+	check(err)
 	return subject
 }
 
@@ -467,18 +531,15 @@ func (d *diff) getBody() string {
 		panic(fmt.Errorf("can't find commit for diff %s", d.id))
 	}
 
-	subject := mustCommand(
-		exec.Command(
-			"git",
-			"show",
-			"-s",
-			"--format=%b",
-			commit,
-		),
-		true,
-		false,
-	)
-	return subject
+	body, err := commitField(commit, "%b")
+	check(err)
+	return body
+}
+
+// commitField returns part of a commit formatted with a git log format, e.g.
+// %s for the subject
+func commitField(commit, format string) (string, error) {
+	return commandOutput(exec.Command("git", "show", "-s", fmt.Sprintf("--format=%s", format), commit))
 }
 
 func (d *diff) isSaved() bool {
@@ -527,22 +588,14 @@ func (d *diff) childDiff(ctx context.Context) (*diff, error) {
 }
 
 func (d *diff) needsSyncing(ctx context.Context) (bool, error) {
-	// check if the diff needs syncing by diffing the commit contents against the
-	// contents on the branch
-	branch := d.branch
-	if branch == "" {
-		return false, fmt.Errorf("diff doesn't have a branch")
-	}
-
-	// get contents of the diff
-	patchID1 := d.git.getPatchID(d.commit)
-	patchID2 := d.git.getPatchID(d.branch)
-
-	if patchID1 != patchID2 {
-		return true, nil
+	// check if the diff needs syncing by comparing the commit against the
+	// version on the branch
+	i, err := d.getInterdiff()
+	if err != nil {
+		return false, err
 	}
 
-	return false, nil
+	return i.changed(), nil
 }
 
 func newDiffFromID(ctx context.Context, diffID string) (*diff, error) {
@@ -550,28 +603,20 @@ func newDiffFromID(ctx context.Context, diffID string) (*diff, error) {
 	// Note: this can and will change as diffs get rebased regularly
 
 	// Loop through all commits between HEAD and base branch
-	commits := mustCommand(
-		exec.Command(
-			"git",
-			"rev-list",
-			"--reverse",
-			fmt.Sprintf("origin/%s...HEAD", client.config.DefaultBranch),
-		),
-		true,
-		false,
-	)
-
-	lines := strings.Split(commits, "\n")
-	var commit string
-	for _, line := range lines {
-		id := diffIDFromCommit(line)
-		if id == diffID {
-			commit = line
-			break
-		}
+	index, err := client.getDiffIndex()
+	if err != nil {
+		return nil, err
 	}
 
 	// Note: commit might be an empty string if the was merged or removed
+	var commit string
+	switch commits := index[diffID]; len(commits) {
+	case 0:
+	case 1:
+		commit = commits[0]
+	default:
+		return nil, duplicateDiffIDError(diffID, commits)
+	}
 
 	instance, err := client.db.getDiff(ctx, diffID)
 	if err != nil {
@@ -587,29 +632,41 @@ func newDiffFromID(ctx context.Context, diffID string) (*diff, error) {
 	}
 
 	return &diff{
-		id:           diffID,
-		commit:       commit,
-		branch:       instance.Branch,
-		prNumber:     instance.PRNumber,
-		parentDiffID: instance.StackedOn, // TODO: fix this naming inconsistency
+		id:               diffID,
+		commit:           commit,
+		branch:           instance.Branch,
+		prNumber:         instance.PRNumber,
+		parentDiffID:     instance.StackedOn, // TODO: fix this naming inconsistency
+		externalBranch:   instance.ExternalBranch,
+		externalPRNumber: instance.ExternalPRNumber,
 	}, nil
 }
 
 func newDiffFromCommit(ctx context.Context, commit string) (*diff, error) {
 	// Check that commit is valid
-	mustCommand(
-		exec.Command("git", "cat-file", "-e", commit),
-		false,
-		false,
-	)
+	_, err := commandOutput(exec.Command("git", "cat-file", "-e", commit))
+	if err != nil {
+		return nil, fmt.Errorf("unknown commit: %s", commit)
+	}
 
 	// Find diff trailer
-	diffID := diffIDFromCommit(commit)
+	diffID, err := diffIDFromCommit(commit)
+	if err != nil {
+		return nil, err
+	}
 
 	if diffID == "" {
 		return nil, fmt.Errorf("commit is missing a Diff-Id")
 	}
 
+	index, err := client.getDiffIndex()
+	if err != nil {
+		return nil, err
+	}
+	if commits := index[diffID]; len(commits) > 1 {
+		return nil, duplicateDiffIDError(diffID, commits)
+	}
+
 	instance, err := client.db.getDiff(ctx, diffID)
 	if err != nil {
 		return nil, err
@@ -624,10 +681,12 @@ func newDiffFromCommit(ctx context.Context, commit string) (*diff, error) {
 	}
 
 	return &diff{
-		id:           diffID,
-		commit:       commit,
-		branch:       instance.Branch,
-		prNumber:     instance.PRNumber,
-		parentDiffID: instance.StackedOn, // TODO: fix this naming inconsistency
+		id:               diffID,
+		commit:           commit,
+		branch:           instance.Branch,
+		prNumber:         instance.PRNumber,
+		parentDiffID:     instance.StackedOn, // TODO: fix this naming inconsistency
+		externalBranch:   instance.ExternalBranch,
+		externalPRNumber: instance.ExternalPRNumber,
 	}, nil
 }
@@ -0,0 +1,173 @@
+package diff
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// diffIDLength is the number of hex characters in a new Diff-Id. Diffs created
+// with the old shell hook have 5 character ids which are still valid.
+const diffIDLength = 10
+
+// maxDiffIDAttempts is how many times to try and generate an id that isn't
+// already used
+const maxDiffIDAttempts = 10
+
+// newDiffID generates a random Diff-Id that isn't used by any saved diff or by
+// any commit in the current branch
+func (c *Diffclient) newDiffID(ctx context.Context) (string, error) {
+	index, err := c.getDiffIndex()
+	if err != nil {
+		return "", err
+	}
+	return generateDiffID(ctx, index, c.db)
+}
+
+// generateDiffID generates a random Diff-Id that isn't in the index of commits
+// or in the db. Either can be nil, in which case there is nothing to check
+// against.
+func generateDiffID(ctx context.Context, index map[string][]string, db *SQLDB) (string, error) {
+	for attempt := 0; attempt < maxDiffIDAttempts; attempt++ {
+		b := make([]byte, diffIDLength/2)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		id := hex.EncodeToString(b)
+
+		if _, ok := index[id]; ok {
+			continue
+		}
+		if db == nil {
+			return id, nil
+		}
+		instance, err := db.getDiff(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if instance == nil {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to generate a unique Diff-Id")
+}
+
+// duplicateDiffIDError explains that more than one commit has the same
+// Diff-Id, which usually happens when a commit is cherry-picked or copied
+func duplicateDiffIDError(id string, commits []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diff-Id %s is used by %d commits:\n", id, len(commits))
+	for _, commit := range commits {
+		d := &diff{commit: commit}
+		fmt.Fprintf(&b, "  %.7s %s\n", commit, d.getSubject())
+	}
+	b.WriteString("run \"gh diff reid <commit>\" on the copy to give it a new Diff-Id")
+	return errors.New(b.String())
+}
+
+// checkDiffIndex returns an error if any Diff-Id is used by more than one
+// commit
+func checkDiffIndex(index map[string][]string) error {
+	ids := make([]string, 0, len(index))
+	for id, commits := range index {
+		if len(commits) > 1 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	errs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		errs = append(errs, duplicateDiffIDError(id, index[id]).Error())
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+// ReIDCommit replaces every Diff-Id trailer of a commit with a single one.
+// The new id is generated unless keepID is given. Dependant commits are
+// rebased on top of the rewritten commit.
+func (c *Diffclient) ReIDCommit(ctx context.Context, rev, keepID string) error {
+	commit, err := runCommand(
+		exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^{commit}", rev)),
+		true,
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("can't find commit %s", rev)
+	}
+	_, err = runCommand(
+		exec.Command("git", "merge-base", "--is-ancestor", commit, "HEAD"),
+		true,
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("commit %.7s isn't in the current branch", commit)
+	}
+
+	ids, err := diffIDsFromCommit(commit)
+	if err != nil {
+		return err
+	}
+	id := keepID
+	if id != "" {
+		found := false
+		for _, existing := range ids {
+			found = found || existing == id
+		}
+		if !found {
+			return fmt.Errorf("commit %.7s doesn't have Diff-Id %s", commit, id)
+		}
+	} else {
+		id, err = c.newDiffID(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	base, commits, err := rebaseRange(commit)
+	if err != nil {
+		return err
+	}
+	todo := []string{}
+	for _, rebaseCommit := range commits {
+		todo = append(todo, fmt.Sprintf("pick %s", rebaseCommit))
+		if rebaseCommit == commit {
+			todo = append(todo, setDiffIDExec(id))
+		}
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%.7s now has Diff-Id: %s\n", commit, id)
+	if len(ids) > 0 {
+		fmt.Printf("replaced: %s\n", strings.Join(ids, ", "))
+	}
+
+	return nil
+}
+
+// setDiffIDExec is a rebase todo line that replaces any Diff-Id trailers of
+// the commit that was just picked with id
+func setDiffIDExec(id string) string {
+	return "exec " + setDiffIDCommand(id)
+}
+
+// setDiffIDCommand is a shell command that replaces any Diff-Id trailers of
+// the HEAD commit with id
+func setDiffIDCommand(id string) string {
+	return fmt.Sprintf(
+		"git log -1 --format=%%B | grep -v -e '^Diff-Id:' -e '^DiffID:' | git interpret-trailers --trailer 'Diff-Id: %s' | git commit --amend --no-verify --allow-empty --cleanup=verbatim -F -",
+		id,
+	)
+}
@@ -0,0 +1,163 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// resolveExternalParent resolves what a diff is being stacked on to a branch
+// and, if there is one, the number of its open PR. ref is either a PR number
+// (#123) or the name of a branch on origin.
+func resolveExternalParent(ref string) (branch, prNumber string, err error) {
+	if number, err := strconv.Atoi(strings.TrimPrefix(ref, "#")); err == nil {
+		pr, err := getRemotePR(number)
+		if err != nil {
+			return "", "", err
+		}
+		if pr.State != string(githubv4.PullRequestStateOpen) {
+			return "", "", fmt.Errorf("PR #%d is %s", pr.Number, strings.ToLower(pr.State))
+		}
+		return pr.HeadRefName, strconv.Itoa(pr.Number), nil
+	}
+
+	if ref == client.config.DefaultBranch {
+		return "", "", fmt.Errorf("diffs are based on %s by default", ref)
+	}
+	exists, err := remoteBranchExists(ref)
+	if err != nil {
+		return "", "", err
+	}
+	if exists == false {
+		return "", "", fmt.Errorf("branch %s doesn't exist on origin", ref)
+	}
+
+	prs, err := getOpenPRs("headRefName", ref)
+	if err != nil {
+		return "", "", err
+	}
+	if len(prs) > 0 {
+		prNumber = strconv.Itoa(prs[0].Number)
+	}
+
+	return ref, prNumber, nil
+}
+
+// remoteBranchExists returns true if a branch exists on origin
+func remoteBranchExists(branch string) (bool, error) {
+	err := exec.Command("git", "ls-remote", "--exit-code", "--heads", "origin", branch).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		// --exit-code exits with 2 when nothing matches
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to list branches on origin: %v", err)
+	}
+	return true, nil
+}
+
+// fetchExternalBranch fetches a branch that isn't a local diff and returns its
+// remote tracking ref
+func fetchExternalBranch(branch string) (string, error) {
+	_, err := runCommand(
+		exec.Command("git", "fetch", "origin", fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)),
+		true,
+		false,
+	)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch %s: %v", branch, err)
+	}
+	return fmt.Sprintf("origin/%s", branch), nil
+}
+
+// externalParentName describes the branch or PR that a diff is stacked on
+func (d *diff) externalParentName() string {
+	if d.externalPRNumber != "" {
+		return fmt.Sprintf("#%s (%s)", d.externalPRNumber, d.externalBranch)
+	}
+	return d.externalBranch
+}
+
+// externalParentMerged returns true once the PR that the diff is stacked on
+// has merged or, without a PR, once the branch is in the default branch or has
+// been deleted
+func (d *diff) externalParentMerged() (bool, error) {
+	if d.externalPRNumber != "" {
+		number, err := strconv.Atoi(d.externalPRNumber)
+		if err != nil {
+			return false, fmt.Errorf("invalid PR number: %s", d.externalPRNumber)
+		}
+		pr, err := getRemotePR(number)
+		if err != nil {
+			return false, err
+		}
+		return pr.State == string(githubv4.PullRequestStateMerged), nil
+	}
+
+	// Without a PR the branch is merged once it's in the default branch (or
+	// it has been deleted)
+	ref, err := fetchExternalBranch(d.externalBranch)
+	if err != nil {
+		exists, existsErr := remoteBranchExists(d.externalBranch)
+		if existsErr != nil {
+			return false, existsErr
+		}
+		if exists {
+			return false, err
+		}
+		return true, nil
+	}
+	mustCommand(exec.Command("git", "fetch", "origin", client.config.DefaultBranch), true, false)
+	_, err = runCommand(
+		exec.Command("git", "merge-base", "--is-ancestor", ref, fmt.Sprintf("origin/%s", client.config.DefaultBranch)),
+		true,
+		false,
+	)
+	return err == nil, nil
+}
+
+// externalBaseRef returns the ref that a diff stacked on an external branch is
+// synced on top of. Once the external PR has merged the diff is retargeted to
+// the default branch.
+func (d *diff) externalBaseRef(ctx context.Context) (string, error) {
+	merged, err := d.externalParentMerged()
+	if err != nil {
+		return "", err
+	}
+	if merged == false {
+		return fetchExternalBranch(d.externalBranch)
+	}
+
+	err = d.retargetFromExternal(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("origin/%s", client.config.DefaultBranch), nil
+}
+
+// retargetFromExternal bases a diff on the default branch instead of the
+// external branch it was stacked on
+func (d *diff) retargetFromExternal(ctx context.Context) error {
+	fmt.Printf("%s has been merged, retargeting %s onto %s\n", d.externalParentName(), d.id, client.config.DefaultBranch)
+
+	err := client.db.updateExternalParent(ctx, d.id, "", "")
+	if err != nil {
+		return err
+	}
+	d.externalBranch = ""
+	d.externalPRNumber = ""
+
+	if d.prNumber != "" {
+		mustCommand(
+			exec.Command("gh", "pr", "edit", d.prNumber, "--base", client.config.DefaultBranch),
+			true,
+			false,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// FetchOptions change how a stack is fetched
+type FetchOptions struct {
+	// Branch is the local branch that the stack is reconstructed in. It
+	// defaults to stack-<number of the top PR>.
+	Branch string
+}
+
+// FetchStack pulls a stack of PRs that was created somewhere else. The PR's
+// base branches are followed down to the default branch, and PRs based on
+// its branch are followed up, to find the whole stack. Each PR becomes a
+// single commit with a Diff-Id in a new local branch and is recorded in the
+// db, with a local copy of its PR branch, so that it can be synced, landed or
+// stacked on like a local diff.
+func (c *Diffclient) FetchStack(ctx context.Context, prRef string, opts FetchOptions) error {
+	number, err := strconv.Atoi(strings.TrimPrefix(prRef, "#"))
+	if err != nil {
+		return fmt.Errorf("invalid PR number: %s", prRef)
+	}
+
+	stack, err := c.findRemoteStack(number)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("found %d PRs in the stack:\n", len(stack))
+	for _, pr := range stack {
+		fmt.Printf("  #%d %s (%s → %s)\n", pr.Number, pr.Title, pr.HeadRefName, pr.BaseRefName)
+	}
+
+	status := mustCommand(exec.Command("git", "status", "--porcelain", "--untracked-files=no"), true, false)
+	if status != "" {
+		return fmt.Errorf("commit or stash your changes before fetching a stack")
+	}
+
+	localBranch := opts.Branch
+	if localBranch == "" {
+		localBranch = fmt.Sprintf("stack-%d", stack[len(stack)-1].Number)
+	}
+	if branchExists(localBranch) {
+		return fmt.Errorf("branch %s already exists", localBranch)
+	}
+	for _, pr := range stack {
+		if pr.HeadRefName == localBranch {
+			return fmt.Errorf("branch %s is the branch of #%d, choose another name with --branch", localBranch, pr.Number)
+		}
+	}
+
+	fetchArgs := []string{"fetch", "origin", c.config.DefaultBranch}
+	for _, pr := range stack {
+		fetchArgs = append(fetchArgs, fmt.Sprintf(
+			"+refs/heads/%s:refs/remotes/origin/%s", pr.HeadRefName, pr.HeadRefName,
+		))
+	}
+	_, err = runCommand(exec.Command("git", fetchArgs...), true, false)
+	if err != nil {
+		return fmt.Errorf("unable to fetch the stack: %v", err)
+	}
+
+	// The local copy of a PR branch replaces an existing branch only if that
+	// doesn't lose any commits
+	newBranches := []string{}
+	for _, pr := range stack {
+		if branchExists(pr.HeadRefName) == false {
+			newBranches = append(newBranches, pr.HeadRefName)
+			continue
+		}
+		_, err = commandOutput(exec.Command(
+			"git", "merge-base", "--is-ancestor",
+			fmt.Sprintf("refs/heads/%s", pr.HeadRefName), fmt.Sprintf("origin/%s", pr.HeadRefName),
+		))
+		if err != nil {
+			return fmt.Errorf(
+				"branch %s has commits that aren't in #%d, push or delete them before fetching the stack",
+				pr.HeadRefName, pr.Number,
+			)
+		}
+	}
+
+	currentBranch := mustCommand(exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD"), true, false)
+	mustCommand(
+		exec.Command("git", "switch", "-c", localBranch, fmt.Sprintf("origin/%s", c.config.DefaultBranch)),
+		true,
+		false,
+	)
+
+	// Leave the repo how it was if anything fails from here on
+	createdIDs := []string{}
+	done := false
+	defer func() {
+		if done {
+			return
+		}
+		mustCommand(exec.Command("git", "switch", currentBranch), true, false)
+		runCommand(exec.Command("git", "branch", "-D", localBranch), true, false)
+		for _, branch := range newBranches {
+			commandOutput(exec.Command("git", "branch", "-D", branch))
+		}
+		for _, id := range createdIDs {
+			c.db.removeDiff(ctx, id)
+		}
+	}()
+
+	ids := make([]string, len(stack))
+	for idx, pr := range stack {
+		ids[idx], err = c.reconstructPR(ctx, pr)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Each diff's branch is a local branch like the branches that sync
+	// creates, so that the interdiff and sync can use it
+	for _, pr := range stack {
+		_, err = runCommand(
+			exec.Command(
+				"git", "branch", "--no-track", "--force",
+				pr.HeadRefName, fmt.Sprintf("origin/%s", pr.HeadRefName),
+			),
+			true,
+			false,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to create branch %s: %v", pr.HeadRefName, err)
+		}
+	}
+
+	for idx, pr := range stack {
+		stackedOn := ""
+		if idx > 0 {
+			stackedOn = ids[idx-1]
+		}
+		prNumber := strconv.Itoa(pr.Number)
+
+		existing, err := c.db.getDiff(ctx, ids[idx])
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			err = c.db.createDiff(ctx, &dbdiff{
+				ID:        ids[idx],
+				Branch:    pr.HeadRefName,
+				PRNumber:  prNumber,
+				StackedOn: stackedOn,
+			})
+			if err == nil {
+				createdIDs = append(createdIDs, ids[idx])
+			}
+		} else {
+			err = c.db.updateStackedOn(ctx, ids[idx], stackedOn)
+			if err == nil {
+				err = c.db.updatePrNumber(ctx, ids[idx], prNumber)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	done = true
+	fmt.Printf("fetched %d diffs into branch %s\n", len(stack), localBranch)
+
+	return nil
+}
+
+// findRemoteStack returns the open PRs in the same stack as a PR, bottom
+// first
+func (c *Diffclient) findRemoteStack(number int) ([]remotePR, error) {
+	pr, err := getRemotePR(number)
+	if err != nil {
+		return nil, err
+	}
+	if pr.State != string(githubv4.PullRequestStateOpen) {
+		return nil, fmt.Errorf("PR #%d is %s", pr.Number, strings.ToLower(pr.State))
+	}
+
+	stack := []remotePR{*pr}
+	seen := map[int]bool{pr.Number: true}
+
+	// Follow the base branches down to the default branch
+	for base := pr.BaseRefName; base != c.config.DefaultBranch; {
+		prs, err := getOpenPRs("headRefName", base)
+		if err != nil {
+			return nil, err
+		}
+		if len(prs) == 0 {
+			return nil, fmt.Errorf(
+				"PR #%d is based on %s which doesn't have an open PR",
+				stack[0].Number, base,
+			)
+		}
+		parent := prs[0]
+		if seen[parent.Number] {
+			return nil, fmt.Errorf("the base branches of PR #%d go round in a loop", number)
+		}
+		seen[parent.Number] = true
+		stack = append([]remotePR{parent}, stack...)
+		base = parent.BaseRefName
+	}
+
+	// Then follow the PRs based on each branch up to the top
+	for {
+		top := stack[len(stack)-1]
+		prs, err := getOpenPRs("baseRefName", top.HeadRefName)
+		if err != nil {
+			return nil, err
+		}
+		if len(prs) == 0 {
+			break
+		}
+		if len(prs) > 1 {
+			fmt.Printf("%d PRs are based on #%d, following the oldest (#%d)\n", len(prs), top.Number, prs[0].Number)
+		}
+		child := prs[0]
+		if seen[child.Number] {
+			break
+		}
+		seen[child.Number] = true
+		stack = append(stack, child)
+	}
+
+	return stack, nil
+}
+
+// reconstructPR squashes the commits of a PR into a single commit on top of
+// HEAD and returns its Diff-Id. The Diff-Id is taken from the PR's commits if
+// it has one, otherwise a new one is generated.
+func (c *Diffclient) reconstructPR(ctx context.Context, pr remotePR) (string, error) {
+	revRange := fmt.Sprintf("origin/%s..origin/%s", pr.BaseRefName, pr.HeadRefName)
+	output := mustCommand(exec.Command("git", "rev-list", "--reverse", "--no-merges", revRange), true, false)
+	commits := []string{}
+	for _, commit := range strings.Split(output, "\n") {
+		if commit != "" {
+			commits = append(commits, commit)
+		}
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("PR #%d doesn't have any commits", pr.Number)
+	}
+
+	var id string
+	for _, commit := range commits {
+		ids, err := diffIDsFromCommit(commit)
+		if err != nil {
+			return "", err
+		}
+		if len(ids) > 0 {
+			id = ids[len(ids)-1]
+		}
+	}
+	if id == "" {
+		var err error
+		id, err = c.newDiffID(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Printf("applying #%d %s\n", pr.Number, pr.Title)
+
+	pickArgs := []string{"cherry-pick", "--allow-empty", commits[0]}
+	if len(commits) > 1 {
+		pickArgs = append([]string{"cherry-pick", "--no-commit"}, commits...)
+	}
+	_, err := runCommand(exec.Command("git", pickArgs...), true, false)
+	if err != nil {
+		runCommand(exec.Command("git", "cherry-pick", "--abort"), true, false)
+		return "", fmt.Errorf("PR #%d doesn't apply on top of the PRs below it: %v", pr.Number, err)
+	}
+
+	if len(commits) > 1 {
+		commitCmd := exec.Command("git", "commit", "--no-verify", "--allow-empty", "-F", "-")
+		commitCmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n\n%s\n", pr.Title, pr.Body))
+		_, err = runCommand(commitCmd, true, false)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = runCommand(exec.Command("sh", "-c", setDiffIDCommand(id)), true, false)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// FoldDiff squashes a diff into the diff below it. The parent keeps its
+// Diff-Id, branch and PR. The child's PR is closed with a comment pointing to
+// the parent's PR, its branch is deleted and any diffs stacked on it are
+// restacked onto the parent. A synced diff can only be folded into a synced
+// parent.
+func (c *Diffclient) FoldDiff(ctx context.Context, ref string) error {
+	child, err := c.resolveDiff(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	parentCommit, err := runCommand(
+		exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^", child.commit)),
+		true,
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("diff %s doesn't have a parent commit to fold into", child.id)
+	}
+	_, err = runCommand(
+		exec.Command(
+			"git", "merge-base", "--is-ancestor",
+			parentCommit, fmt.Sprintf("origin/%s", c.config.DefaultBranch),
+		),
+		true,
+		false,
+	)
+	if err == nil {
+		return fmt.Errorf("the parent of diff %s is already in %s", child.id, c.config.DefaultBranch)
+	}
+
+	parentID, err := diffIDFromCommit(parentCommit)
+	if err != nil {
+		return err
+	}
+	if parentID == "" {
+		return fmt.Errorf("the parent commit of diff %s (%.7s) isn't a diff", child.id, parentCommit)
+	}
+	parent, err := newDiffFromCommit(ctx, parentCommit)
+	if err != nil {
+		return err
+	}
+	// The folded diff takes over the child's place on GitHub so the parent
+	// needs a branch and PR of its own
+	if child.isSaved() && parent.isSaved() == false {
+		return fmt.Errorf(
+			"diff %s has been synced but %s hasn't, sync %s first so that the folded diff has a PR",
+			child.id, parent.id, parent.id,
+		)
+	}
+
+	fmt.Printf(
+		"folding %s (%s) into %s (%s)\n",
+		child.getSubject(), child.id, parent.getSubject(), parent.id,
+	)
+
+	// Squash the commits first so that nothing is changed on GitHub if the
+	// rebase fails. fixup keeps the parent's message and so its Diff-Id.
+	base, rebaseCommits, err := rebaseRange(parentCommit)
+	if err != nil {
+		return err
+	}
+	todo := []string{}
+	for _, commit := range rebaseCommits {
+		if commit == child.commit {
+			todo = append(todo, fmt.Sprintf("fixup %s", commit))
+		} else {
+			todo = append(todo, fmt.Sprintf("pick %s", commit))
+		}
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		return err
+	}
+
+	var restacked []string
+	if child.isSaved() {
+		restacked, err = c.restackChildren(ctx, child, parent.id, "", "", parent.branch)
+		if err != nil {
+			return err
+		}
+
+		comment := fmt.Sprintf("Folded into %s (%s)", parent.getSubject(), parent.branch)
+		if parent.prNumber != "" {
+			comment = fmt.Sprintf("Folded into #%s", parent.prNumber)
+		}
+		err = c.deleteDiff(ctx, child, comment)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("folded %s into %s\n", child.id, parent.id)
+
+	// Push the folded diff and then the diffs that were stacked on the child
+	if parent.isSaved() {
+		err = c.SyncDiff(ctx, parent.id, SyncOptions{SkipDependants: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.syncRestacked(ctx, restacked)
+}
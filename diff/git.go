@@ -9,16 +9,15 @@ import (
 type gitcmd struct {
 }
 
-func (c *gitcmd) getPatch(ref string, base string) string {
+func (c *gitcmd) getPatch(ref string, base string) (string, error) {
 	cmd := exec.Command(
 		"git", "diff", "--no-ext-diff", "--unified=0", base, ref,
 	)
 
-	rawCommitContents := mustCommand(
-		cmd,
-		true,
-		false,
-	)
+	rawCommitContents, err := commandOutput(cmd)
+	if err != nil {
+		return "", err
+	}
 
 	var commitContents strings.Builder
 	// filter out index lines
@@ -31,36 +30,78 @@ func (c *gitcmd) getPatch(ref string, base string) string {
 		commitContents.WriteString("\n")
 	}
 
-	return commitContents.String()
+	return commitContents.String(), nil
 }
 
-func (c *gitcmd) getPatchID(ref string) string {
+func (c *gitcmd) getPatchID(ref string) (string, error) {
 	rawCmd := fmt.Sprintf("git show %s | git patch-id --stable", ref)
 
 	cmd := exec.Command(
 		"bash", "-c", rawCmd,
 	)
 
-	output := mustCommand(
-		cmd,
-		true,
-		false,
-	)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return "", err
+	}
 
 	parts := strings.Split(output, " ")
-	return parts[0]
+	return parts[0], nil
 }
 
-func (c *gitcmd) getMergeBase(commitA string, commitB string) string {
+func (c *gitcmd) getMergeBase(commitA string, commitB string) (string, error) {
 	cmd := exec.Command(
 		"git", "merge-base", commitA, commitB,
 	)
 
-	mergeBase := mustCommand(
-		cmd,
-		true,
-		false,
+	return commandOutput(cmd)
+}
+
+func (c *gitcmd) getDiffStat(ref string, base string) (string, error) {
+	cmd := exec.Command(
+		"git", "diff", "--no-ext-diff", "--stat", base, ref,
+	)
+
+	return commandOutput(cmd)
+}
+
+// getRangeDiff compares two versions of a single commit patch
+func (c *gitcmd) getRangeDiff(oldRef string, newRef string) (string, error) {
+	cmd := exec.Command(
+		"git", "range-diff", "--no-color",
+		fmt.Sprintf("%s^..%s", oldRef, oldRef),
+		fmt.Sprintf("%s^..%s", newRef, newRef),
 	)
 
-	return mergeBase
+	return commandOutput(cmd)
+}
+
+// getFilePatches splits the patch of a commit up by file
+func (c *gitcmd) getFilePatches(ref string) (map[string]string, error) {
+	patch, err := c.getPatch(ref, fmt.Sprintf("%s^", ref))
+	if err != nil {
+		return nil, err
+	}
+
+	patches := map[string]string{}
+	var file string
+	var filePatch strings.Builder
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			if file != "" {
+				patches[file] = filePatch.String()
+			}
+			filePatch.Reset()
+			// diff --git a/<file> b/<file>
+			parts := strings.SplitN(line, " b/", 2)
+			file = parts[len(parts)-1]
+		}
+		filePatch.WriteString(line)
+		filePatch.WriteString("\n")
+	}
+	if file != "" {
+		patches[file] = filePatch.String()
+	}
+
+	return patches, nil
 }
@@ -1,8 +1,11 @@
 package diff
 
 import (
+	"fmt"
 	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/shurcooL/githubv4"
 )
@@ -40,3 +43,324 @@ func createPR(baseRef, branchName, title, body string) (prNumber string, err err
 
 	return strconv.Itoa(mutation.CreatePullRequest.PullRequest.Number), err
 }
+
+func getRepoOwnerAndName() (owner string, name string, err error) {
+	nameWithOwner, err := commandOutput(
+		exec.Command("gh", "repo", "view", "--json=nameWithOwner", "--jq=.nameWithOwner"),
+	)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(nameWithOwner, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("unexpected repo name: %s", nameWithOwner)
+	}
+	return parts[0], parts[1], nil
+}
+
+const prStatusFragment = `
+fragment prStatus on PullRequest {
+	number
+	state
+	isDraft
+	mergeable
+	reviewDecision
+	commits(last: 1) {
+		nodes {
+			commit {
+				statusCheckRollup {
+					state
+				}
+			}
+		}
+	}
+	reviewThreads(first: 100) {
+		nodes {
+			isResolved
+		}
+	}
+}
+`
+
+// prStatus is the review, CI and mergeability state of a PR
+type prStatus struct {
+	Number         int
+	State          string
+	IsDraft        bool
+	Mergeable      string
+	ReviewDecision string
+	Commits        struct {
+		Nodes []struct {
+			Commit struct {
+				StatusCheckRollup *struct {
+					State string
+				}
+			}
+		}
+	}
+	ReviewThreads struct {
+		Nodes []struct {
+			IsResolved bool
+		}
+	}
+}
+
+// checksState returns the rollup state of the checks on the PR's head commit
+// or an empty string if there are no checks
+func (s *prStatus) checksState() string {
+	if len(s.Commits.Nodes) == 0 {
+		return ""
+	}
+	rollup := s.Commits.Nodes[0].Commit.StatusCheckRollup
+	if rollup == nil {
+		return ""
+	}
+	return rollup.State
+}
+
+func (s *prStatus) unresolvedThreads() int {
+	count := 0
+	for _, thread := range s.ReviewThreads.Nodes {
+		if thread.IsResolved == false {
+			count++
+		}
+	}
+	return count
+}
+
+// getPRStatuses fetches the status of all the PRs in a single request. The
+// result is keyed by PR number.
+func getPRStatuses(prNumbers []string) (map[string]*prStatus, error) {
+	statuses := map[string]*prStatus{}
+	if len(prNumbers) == 0 {
+		return statuses, nil
+	}
+
+	owner, name, err := getRepoOwnerAndName()
+	if err != nil {
+		return nil, err
+	}
+
+	var query strings.Builder
+	query.WriteString("query PRStatuses($owner: String!, $name: String!) {\n")
+	query.WriteString("\trepository(owner: $owner, name: $name) {\n")
+	for _, prNumber := range prNumbers {
+		// PR numbers are interpolated into the query so make sure they are
+		// actually numbers
+		if _, err := strconv.Atoi(prNumber); err != nil {
+			return nil, fmt.Errorf("invalid PR number: %s", prNumber)
+		}
+		query.WriteString(fmt.Sprintf("\t\tpr%s: pullRequest(number: %s) { ...prStatus }\n", prNumber, prNumber))
+	}
+	query.WriteString("\t}\n}\n")
+	query.WriteString(prStatusFragment)
+
+	variables := map[string]interface{}{
+		"owner": owner,
+		"name":  name,
+	}
+
+	var response struct {
+		Repository map[string]*prStatus
+	}
+	err = client.ghClient.Do(query.String(), variables, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prNumber := range prNumbers {
+		if status, ok := response.Repository["pr"+prNumber]; ok && status != nil {
+			statuses[prNumber] = status
+		}
+	}
+
+	return statuses, nil
+}
+
+// prComment is a review or comment on a PR
+type prComment struct {
+	Author struct {
+		Login string
+	}
+	State     string
+	Body      string
+	CreatedAt time.Time
+}
+
+// getPRComments fetches the reviews and top level comments of a PR
+func getPRComments(prNumber string) (reviews []prComment, comments []prComment, err error) {
+	number, err := strconv.Atoi(prNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid PR number: %s", prNumber)
+	}
+
+	owner, name, err := getRepoOwnerAndName()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var query struct {
+		Repository struct {
+			PullRequest struct {
+				Reviews struct {
+					Nodes []prComment
+				} `graphql:"reviews(last: 50)"`
+				Comments struct {
+					Nodes []struct {
+						Author struct {
+							Login string
+						}
+						Body      string
+						CreatedAt time.Time
+					}
+				} `graphql:"comments(last: 50)"`
+			} `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"name":   githubv4.String(name),
+		"number": githubv4.Int(number),
+	}
+
+	err = client.ghClient.Query("PRComments", &query, variables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, c := range query.Repository.PullRequest.Comments.Nodes {
+		comment := prComment{Body: c.Body, CreatedAt: c.CreatedAt}
+		comment.Author.Login = c.Author.Login
+		comments = append(comments, comment)
+	}
+
+	return query.Repository.PullRequest.Reviews.Nodes, comments, nil
+}
+
+// addPRComment adds a comment to a PR
+func addPRComment(prNumber, body string) error {
+	number, err := strconv.Atoi(prNumber)
+	if err != nil {
+		return fmt.Errorf("invalid PR number: %s", prNumber)
+	}
+
+	owner, name, err := getRepoOwnerAndName()
+	if err != nil {
+		return err
+	}
+
+	var query struct {
+		Repository struct {
+			PullRequest struct {
+				ID string
+			} `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	err = client.ghClient.Query("PRID", &query, map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"name":   githubv4.String(name),
+		"number": githubv4.Int(number),
+	})
+	if err != nil {
+		return err
+	}
+
+	var mutation struct {
+		AddComment struct {
+			CommentEdge struct {
+				Node struct {
+					ID string
+				}
+			}
+		} `graphql:"addComment(input: $input)"`
+	}
+
+	variables := map[string]interface{}{
+		"input": githubv4.AddCommentInput{
+			SubjectID: githubv4.ID(query.Repository.PullRequest.ID),
+			Body:      githubv4.String(body),
+		},
+	}
+
+	return client.ghClient.Mutate("AddComment", &mutation, variables)
+}
+
+// remotePR is a PR on GitHub that might not have been created locally
+type remotePR struct {
+	Number      int
+	State       string
+	Title       string
+	Body        string
+	HeadRefName string
+	BaseRefName string
+}
+
+// getRemotePR fetches a PR by number
+func getRemotePR(number int) (*remotePR, error) {
+	owner, name, err := getRepoOwnerAndName()
+	if err != nil {
+		return nil, err
+	}
+
+	var query struct {
+		Repository struct {
+			PullRequest *remotePR `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	err = client.ghClient.Query("RemotePR", &query, map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"name":   githubv4.String(name),
+		"number": githubv4.Int(number),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if query.Repository.PullRequest == nil {
+		return nil, fmt.Errorf("PR #%d doesn't exist", number)
+	}
+
+	return query.Repository.PullRequest, nil
+}
+
+// getOpenPRs fetches the open PRs with a head branch (headRefName) or a base
+// branch (baseRefName), oldest first
+func getOpenPRs(filter, branch string) ([]remotePR, error) {
+	owner, name, err := getRepoOwnerAndName()
+	if err != nil {
+		return nil, err
+	}
+
+	var query struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []remotePR
+			} `graphql:"pullRequests(headRefName: $head, baseRefName: $base, states: $states, first: 10, orderBy: {field: CREATED_AT, direction: ASC})"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(owner),
+		"name":   githubv4.String(name),
+		"states": []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
+		"head":   (*githubv4.String)(nil),
+		"base":   (*githubv4.String)(nil),
+	}
+	switch filter {
+	case "headRefName":
+		variables["head"] = githubv4.NewString(githubv4.String(branch))
+	case "baseRefName":
+		variables["base"] = githubv4.NewString(githubv4.String(branch))
+	default:
+		return nil, fmt.Errorf("unknown PR filter: %s", filter)
+	}
+
+	err = client.ghClient.Query("OpenPRs", &query, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Repository.PullRequests.Nodes, nil
+}
@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jkimbo/gh-diff/hooks"
+)
+
+// installCommitMsgHook installs the commit-msg hook into the hooks directory,
+// which respects core.hooksPath. A hook that is already there is kept and run
+// before the gh-diff hook.
+func installCommitMsgHook() error {
+	hooksDir := mustCommand(
+		exec.Command("git", "rev-parse", "--git-path", "hooks"),
+		true,
+		false,
+	)
+	err := os.MkdirAll(hooksDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("unable to create hooks dir: %v", err)
+	}
+
+	hookPath := filepath.Join(hooksDir, "commit-msg")
+	existing, err := os.ReadFile(hookPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case isGhDiffHook(existing):
+		// Either the old shell hook or an older version of this hook so just
+		// replace it
+		fmt.Println("updating commit-msg hook")
+	default:
+		chainedPath := hookPath + ".chained"
+		if _, err := os.Stat(chainedPath); err == nil {
+			return fmt.Errorf(
+				"can't install commit-msg hook: both %s and %s already exist",
+				hookPath, chainedPath,
+			)
+		}
+		fmt.Printf("existing commit-msg hook moved to %s and will still be run\n", chainedPath)
+		err = os.Rename(hookPath, chainedPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(hookPath, hooks.CommitMsg, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to write commit-msg hook: %v", err)
+	}
+	fmt.Printf("commit-msg hook installed at %s\n", hookPath)
+
+	return nil
+}
+
+// isGhDiffHook returns true for hooks installed by any version of gh-diff,
+// including the original shell hook
+func isGhDiffHook(hook []byte) bool {
+	return bytes.Contains(hook, []byte(hooks.Marker)) ||
+		bytes.Contains(hook, []byte(`--trailer "Diff-Id: ${random}"`))
+}
+
+// CommitMsgHook adds a Diff-Id trailer to a commit message file, unless it
+// already has one. It's run by the commit-msg hook.
+func CommitMsgHook(ctx context.Context, path string) error {
+	message, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	stripCmd := exec.Command("git", "stripspace", "--strip-comments")
+	stripCmd.Stdin = bytes.NewReader(message)
+	stripped, err := stripCmd.Output()
+	if err != nil {
+		return fmt.Errorf("cannot strip comments from %s: %v", path, err)
+	}
+	if len(bytes.TrimSpace(stripped)) == 0 {
+		// git aborts the commit because the message is empty
+		return nil
+	}
+
+	parseCmd := exec.Command("git", "interpret-trailers", "--parse")
+	parseCmd.Stdin = bytes.NewReader(stripped)
+	trailers, err := parseCmd.Output()
+	if err != nil {
+		return fmt.Errorf("cannot parse trailers: %v", err)
+	}
+	for _, line := range strings.Split(string(trailers), "\n") {
+		if strings.HasPrefix(line, "Diff-Id:") {
+			return nil
+		}
+	}
+
+	// The hook has to work before init has been run and without a network
+	// connection so only check for collisions against what is there. The db
+	// isn't migrated so that committing never changes it.
+	var index map[string][]string
+	var db *SQLDB
+	local := &Diffclient{}
+	if err := local.load(ctx); err == nil {
+		db = local.db
+		// The default branch might not have been fetched yet
+		index, _ = local.getDiffIndex()
+	}
+
+	id, err := generateDiffID(ctx, index, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = runCommand(
+		exec.Command(
+			"git", "interpret-trailers", "--in-place",
+			"--trailer", fmt.Sprintf("Diff-Id: %s", id),
+			path,
+		),
+		true,
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot insert Diff-Id into %s: %v", path, err)
+	}
+
+	return nil
+}
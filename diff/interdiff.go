@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// interdiff describes how a local commit differs from the version of the diff
+// that was last pushed
+type interdiff struct {
+	// contentChanged is set if the changes themselves are different
+	contentChanged bool
+	// rebaseOnly is set if the changes are the same but the context around
+	// them is different because the commit has been rebased
+	rebaseOnly bool
+	// messageChanged is set if the commit message is different
+	messageChanged bool
+	// rangeDiff is the output of git range-diff between the two versions
+	rangeDiff string
+}
+
+func (i *interdiff) changed() bool {
+	return i.contentChanged || i.rebaseOnly || i.messageChanged
+}
+
+// needsReview returns true if pushing the local commit will change what
+// reviewers have already looked at
+func (i *interdiff) needsReview() bool {
+	return i.contentChanged
+}
+
+// reason is a short description of why the diff needs syncing
+func (i *interdiff) reason() string {
+	var reasons []string
+	if i.contentChanged {
+		reasons = append(reasons, "content")
+	}
+	if i.rebaseOnly {
+		reasons = append(reasons, "rebase")
+	}
+	if i.messageChanged {
+		reasons = append(reasons, "message")
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// summary describes the interdiff in a few lines
+func (i *interdiff) summary() []string {
+	if i.changed() == false {
+		return []string{"no changes since the last sync"}
+	}
+
+	var lines []string
+	if i.contentChanged {
+		lines = append(lines, "content changed: the changes are different to the pushed version")
+	}
+	if i.rebaseOnly {
+		lines = append(lines, "rebase only: the changes are the same but have been rebased")
+	}
+	if i.messageChanged {
+		lines = append(lines, "message changed: the commit message has been edited")
+	}
+	if i.needsReview() {
+		lines = append(lines, "syncing will need a re-review")
+	} else {
+		lines = append(lines, "syncing won't change what reviewers have seen")
+	}
+	return lines
+}
+
+// getInterdiff compares the local commit of a diff with its pushed branch
+func (d *diff) getInterdiff() (*interdiff, error) {
+	if d.branch == "" {
+		return nil, fmt.Errorf("diff doesn't have a branch")
+	}
+	if d.commit == "" {
+		return nil, fmt.Errorf("can't find commit for diff %s", d.id)
+	}
+
+	result := &interdiff{}
+
+	localPatchID, err := d.git.getPatchID(d.commit)
+	if err != nil {
+		return nil, err
+	}
+	remotePatchID, err := d.git.getPatchID(d.branch)
+	if err != nil {
+		return nil, err
+	}
+	if localPatchID != remotePatchID {
+		// The patch id includes the context around each change so compare
+		// the changes without any context to see if it was only a rebase
+		localPatch, err := d.git.getPatch(d.commit, fmt.Sprintf("%s^", d.commit))
+		if err != nil {
+			return nil, err
+		}
+		remotePatch, err := d.git.getPatch(d.branch, fmt.Sprintf("%s^", d.branch))
+		if err != nil {
+			return nil, err
+		}
+		if stripHunkHeaders(localPatch) == stripHunkHeaders(remotePatch) {
+			result.rebaseOnly = true
+		} else {
+			result.contentChanged = true
+		}
+	}
+
+	localMessage, err := commitField(d.commit, "%B")
+	if err != nil {
+		return nil, err
+	}
+	remoteMessage, err := commitField(d.branch, "%B")
+	if err != nil {
+		return nil, err
+	}
+	result.messageChanged = strings.TrimSpace(localMessage) != strings.TrimSpace(remoteMessage)
+
+	if result.changed() {
+		result.rangeDiff, err = d.git.getRangeDiff(d.branch, d.commit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// stripHunkHeaders removes the line numbers from a patch
+func stripHunkHeaders(patch string) string {
+	var stripped strings.Builder
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			continue
+		}
+		stripped.WriteString(line)
+		stripped.WriteString("\n")
+	}
+	return stripped.String()
+}
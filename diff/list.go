@@ -0,0 +1,249 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+	"github.com/jkimbo/gh-diff/tui"
+)
+
+// ListOptions controls the output of ListDiffs
+type ListOptions struct {
+	// JSON outputs the diffs as a JSON array
+	JSON bool
+	// Template is a Go template that is executed with the JSON array
+	Template string
+	// JQ is a jq expression that filters the JSON array
+	JQ string
+}
+
+// listItem is the JSON representation of a diff. It has the same data as the
+// dashboard items.
+type listItem struct {
+	ID                string `json:"id"`
+	Commit            string `json:"commit"`
+	Title             string `json:"title"`
+	Author            string `json:"author"`
+	Branch            string `json:"branch"`
+	PrNumber          string `json:"prNumber"`
+	PrURL             string `json:"prUrl"`
+	StackedOn         string `json:"stackedOn"`
+	StackedOnExternal string `json:"stackedOnExternal"`
+	IsSynced          bool   `json:"isSynced"`
+	IsStacked         bool   `json:"isStacked"`
+	IsLanded          bool   `json:"isLanded"`
+	NeedsSyncing      bool   `json:"needsSyncing"`
+	SyncReason        string `json:"syncReason"`
+	ReviewStatus      string `json:"reviewStatus"`
+	ChecksStatus      string `json:"checksStatus"`
+	MergeStatus       string `json:"mergeStatus"`
+	IsDraft           bool   `json:"isDraft"`
+	UnresolvedThreads int    `json:"unresolvedThreads"`
+}
+
+func toListItem(item tui.Item) listItem {
+	l := listItem{
+		ID:                item.ID,
+		Commit:            item.Commit,
+		Title:             item.Title,
+		Author:            item.Author,
+		Branch:            item.Branch,
+		PrNumber:          item.PrNumber,
+		PrURL:             item.PrLink,
+		StackedOn:         item.StackedOn,
+		StackedOnExternal: item.StackedOnExternal,
+		IsSynced:          item.IsSaved,
+		IsStacked:         item.IsStacked,
+		IsLanded:          item.IsLanded,
+		NeedsSyncing:      item.NeedsSyncing,
+		SyncReason:        item.SyncReason,
+	}
+	if item.HasPrStatus {
+		l.ReviewStatus = item.PrReviewStatus.String()
+		l.ChecksStatus = item.PrChecksStatus.String()
+		l.MergeStatus = item.PrMergeStatus.String()
+		l.IsDraft = item.PrIsDraft
+		l.UnresolvedThreads = item.PrUnresolvedThreads
+	}
+	return l
+}
+
+// loadListItems loads everything that the dashboard shows, without the
+// dashboard
+func (c *Diffclient) loadListItems(ctx context.Context) ([]tui.Item, error) {
+	backend := newDashboardBackend(ctx)
+
+	items, err := backend.LoadItems()
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, item := range items {
+		if item.Commit == "" || item.ID == "" {
+			continue
+		}
+		items[idx], err = backend.LoadItem(item)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses, err := backend.LoadPrStatuses(items)
+	if err != nil {
+		return nil, err
+	}
+	for idx, item := range items {
+		if status, ok := statuses[item.Commit]; ok {
+			items[idx] = status
+			// LoadPrStatuses works on the items before they were loaded
+			items[idx].IsStacked = item.IsStacked
+			items[idx].NeedsSyncing = item.NeedsSyncing
+			items[idx].SyncReason = item.SyncReason
+		}
+	}
+
+	return items, nil
+}
+
+// ListDiffs prints every diff between HEAD and the default branch
+func (c *Diffclient) ListDiffs(ctx context.Context, opts ListOptions) error {
+	items, err := c.loadListItems(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !opts.JSON && opts.Template == "" && opts.JQ == "" {
+		return printListTable(os.Stdout, items)
+	}
+
+	listItems := make([]listItem, 0, len(items))
+	for _, item := range items {
+		listItems = append(listItems, toListItem(item))
+	}
+
+	data, err := json.Marshal(listItems)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.JQ != "":
+		return printJQ(os.Stdout, data, opts.JQ)
+	case opts.Template != "":
+		return printTemplate(os.Stdout, data, opts.Template)
+	}
+
+	var out bytes.Buffer
+	err = json.Indent(&out, data, "", "  ")
+	if err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
+
+func printListTable(w io.Writer, items []tui.Item) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPR\tSTATUS\tCHECKS\tREVIEW\tTITLE")
+	for _, item := range items {
+		id := item.ID
+		if id == "" {
+			id = "-"
+		}
+		pr := "-"
+		if item.PrNumber != "" {
+			pr = "#" + item.PrNumber
+		}
+
+		var status string
+		switch {
+		case item.IsLanded:
+			status = "landed"
+		case item.ID == "":
+			status = "no Diff-Id"
+		case !item.IsSaved:
+			status = "unsynced"
+		case item.NeedsSyncing:
+			status = fmt.Sprintf("needs sync (%s)", item.SyncReason)
+		default:
+			status = "synced"
+		}
+
+		checks, review := "-", "-"
+		if item.HasPrStatus {
+			checks = item.PrChecksStatus.String()
+			review = item.PrReviewStatus.String()
+			if item.PrIsDraft {
+				review = "draft"
+			}
+		}
+
+		title := item.Title
+		if item.IsLanded {
+			title = item.Branch
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", id, pr, status, checks, review, title)
+	}
+	return tw.Flush()
+}
+
+// printJQ filters the JSON with a jq expression. Strings are printed without
+// quotes so that the output can be used in scripts.
+func printJQ(w io.Writer, data []byte, expr string) error {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return fmt.Errorf("invalid jq expression: %v", err)
+	}
+
+	var input interface{}
+	err = json.Unmarshal(data, &input)
+	if err != nil {
+		return err
+	}
+
+	iter := query.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return err
+		}
+		if s, ok := v.(string); ok {
+			fmt.Fprintln(w, s)
+			continue
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(out))
+	}
+	return nil
+}
+
+// printTemplate executes a Go template with the JSON
+func printTemplate(w io.Writer, data []byte, tmpl string) error {
+	t, err := template.New("list").Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("invalid template: %v", err)
+	}
+
+	var input interface{}
+	err = json.Unmarshal(data, &input)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, input)
+}
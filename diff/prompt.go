@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/core"
+	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/mattn/go-isatty"
+)
+
+// interactive returns true if there is a terminal to ask questions on. It's
+// false when gh-diff is run from a script or by the dashboard.
+func interactive() bool {
+	for _, file := range []*os.File{os.Stdin, os.Stdout} {
+		if !isatty.IsTerminal(file.Fd()) && !isatty.IsCygwinTerminal(file.Fd()) {
+			return false
+		}
+	}
+	return true
+}
+
+// askOne asks a survey question and turns an interrupt into an error. Without
+// a terminal the question is answered with its default, or an error is
+// returned if it doesn't have one.
+func askOne(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+	if !interactive() {
+		return answerDefault(prompt, response)
+	}
+
+	err := survey.AskOne(prompt, response, opts...)
+	if err == terminal.InterruptErr {
+		return fmt.Errorf("cancelled")
+	}
+	return err
+}
+
+// answerDefault writes the default answer of a prompt to response
+func answerDefault(prompt survey.Prompt, response interface{}) error {
+	var message string
+	switch p := prompt.(type) {
+	case *survey.Input:
+		message = p.Message
+		if p.Default != "" {
+			fmt.Printf("%s %s\n", p.Message, p.Default)
+			return core.WriteAnswer(response, "", p.Default)
+		}
+	case *survey.Confirm:
+		fmt.Printf("%s %t\n", p.Message, p.Default)
+		return core.WriteAnswer(response, "", p.Default)
+	case *survey.Select:
+		message = p.Message
+		for idx, option := range p.Options {
+			if option == p.Default {
+				fmt.Printf("%s %s\n", p.Message, option)
+				return core.WriteAnswer(response, "", core.OptionAnswer{Value: option, Index: idx})
+			}
+		}
+	case *survey.MultiSelect:
+		message = p.Message
+	}
+
+	return fmt.Errorf("can't answer %q without a terminal", message)
+}
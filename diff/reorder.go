@@ -0,0 +1,316 @@
+package diff
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ReorderDiffs reorders the commits between the default branch and HEAD. The
+// new order (oldest first) is given as refs to every commit or, if refs is
+// empty, edited in the git editor. After the rebase the stacked_on links are
+// rewritten to match the new order, the base branches of PRs are retargeted
+// and the branches of every diff that moved are synced.
+//
+// A diff that was part of a stack is stacked on whatever diff is below it
+// after the reorder. Diffs that weren't stacked stay based on the default
+// branch.
+func (c *Diffclient) ReorderDiffs(ctx context.Context, refs []string) error {
+	if err := checkCanRewrite(); err != nil {
+		return err
+	}
+
+	output := mustCommand(
+		exec.Command("git", "rev-list", "--reverse", fmt.Sprintf("origin/%s..HEAD", c.config.DefaultBranch)),
+		true,
+		false,
+	)
+	current := []string{}
+	for _, commit := range strings.Split(output, "\n") {
+		if commit != "" {
+			current = append(current, commit)
+		}
+	}
+	if len(current) < 2 {
+		return fmt.Errorf("there needs to be more than one commit to reorder")
+	}
+
+	var order []string
+	var err error
+	if len(refs) == 0 {
+		if !interactive() {
+			return fmt.Errorf("give the new order as arguments, there is no terminal to edit it in")
+		}
+		order, err = editOrder(current)
+	} else {
+		order, err = c.resolveOrder(ctx, refs)
+	}
+	if err != nil {
+		return err
+	}
+	err = checkOrder(current, order)
+	if err != nil {
+		return err
+	}
+
+	first := 0
+	for first < len(order) && order[first] == current[first] {
+		first++
+	}
+	if first == len(order) {
+		fmt.Println("the order hasn't changed")
+		return nil
+	}
+
+	// Load the diffs before the rebase changes their commits
+	diffs := map[string]*diff{}
+	for _, commit := range current {
+		id, err := diffIDFromCommit(commit)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			continue
+		}
+		d, err := newDiffFromCommit(ctx, commit)
+		if err != nil {
+			return err
+		}
+		diffs[commit] = d
+	}
+	inStack := map[string]bool{}
+	for _, d := range diffs {
+		if d.isSaved() && d.parentDiffID != "" {
+			inStack[d.id] = true
+			inStack[d.parentDiffID] = true
+		}
+	}
+
+	base, _, err := rebaseRange(current[first])
+	if err != nil {
+		return err
+	}
+	todo := []string{}
+	for _, commit := range order[first:] {
+		todo = append(todo, fmt.Sprintf("pick %s", commit))
+	}
+	err = runRebase(base, todo)
+	if err != nil {
+		return fmt.Errorf("unable to reorder the commits, nothing has been changed\n%v", err)
+	}
+
+	// Rewrite stacked_on to follow the new order
+	restacked := map[string]bool{}
+	var moved []*diff
+	for idx := first; idx < len(order); idx++ {
+		d := diffs[order[idx]]
+		if d == nil || d.isSaved() == false {
+			continue
+		}
+		moved = append(moved, d)
+
+		stackedOn := ""
+		if inStack[d.id] && idx > 0 {
+			parent := diffs[order[idx-1]]
+			if parent != nil && parent.isSaved() {
+				stackedOn = parent.id
+			} else {
+				fmt.Printf(
+					"the commit below %s isn't a synced diff so it's now based on %s\n",
+					d.id, c.config.DefaultBranch,
+				)
+			}
+		}
+		if stackedOn == d.parentDiffID {
+			continue
+		}
+
+		fmt.Printf("restacking %s onto %s\n", d.id, stackedOnName(stackedOn, c.config.DefaultBranch))
+		err = c.db.updateStackedOn(ctx, d.id, stackedOn)
+		if err != nil {
+			return err
+		}
+		restacked[d.id] = true
+	}
+
+	// Sync from the bottom up so that each diff's base branch has already
+	// been pushed. The commits have already been reordered so keep going if a
+	// diff can't be synced and report them all at the end.
+	var failed []string
+	for _, old := range moved {
+		d, err := newDiffFromID(ctx, old.id)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("syncing diff: %s (%s)\n", d.getSubject(), d.id)
+		ok := true
+		err = d.Sync(ctx)
+		if err != nil {
+			fmt.Printf("unable to sync %s: %v\n", d.id, err)
+			ok = false
+		}
+
+		// The PR is retargeted even if the sync failed so that syncing it
+		// later is enough to fix it
+		if restacked[d.id] && d.prNumber != "" {
+			baseRef := c.config.DefaultBranch
+			parent, err := d.parentDiff(ctx)
+			if err != nil {
+				return err
+			}
+			if parent != nil {
+				baseRef = parent.branch
+			}
+			fmt.Printf("retargeting PR #%s onto %s\n", d.prNumber, baseRef)
+			_, err = runCommand(
+				exec.Command("gh", "pr", "edit", d.prNumber, "--base", baseRef),
+				true,
+				false,
+			)
+			if err != nil {
+				fmt.Printf(
+					"unable to retarget PR #%s, run \"gh pr edit %s --base %s\": %v\n",
+					d.prNumber, d.prNumber, baseRef, err,
+				)
+				ok = false
+			}
+		}
+
+		if !ok {
+			failed = append(failed, d.id)
+		}
+	}
+
+	fmt.Printf("reordered %d commits\n", len(order)-first)
+
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"%d of %d diffs couldn't be synced, run \"gh diff sync\" on each of them: %s",
+			len(failed), len(moved), strings.Join(failed, ", "),
+		)
+	}
+
+	return nil
+}
+
+func stackedOnName(stackedOn, defaultBranch string) string {
+	if stackedOn == "" {
+		return defaultBranch
+	}
+	return stackedOn
+}
+
+// resolveOrder resolves the refs of the new order to commits
+func (c *Diffclient) resolveOrder(ctx context.Context, refs []string) ([]string, error) {
+	order := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		commit, err := c.resolveCommit(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		order = append(order, commit)
+	}
+	return order, nil
+}
+
+// checkOrder makes sure that order contains every commit exactly once
+func checkOrder(current, order []string) error {
+	inBranch := map[string]bool{}
+	for _, commit := range current {
+		inBranch[commit] = true
+	}
+
+	seen := map[string]bool{}
+	var errs []string
+	for _, commit := range order {
+		if !inBranch[commit] {
+			errs = append(errs, fmt.Sprintf("%.7s isn't in the current branch", commit))
+		} else if seen[commit] {
+			errs = append(errs, fmt.Sprintf("%.7s is in the order more than once", commit))
+		}
+		seen[commit] = true
+	}
+	for _, commit := range current {
+		if !seen[commit] {
+			errs = append(errs, fmt.Sprintf("%.7s is missing from the order", commit))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid order:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	return nil
+}
+
+// editOrder opens the commits in the git editor, oldest first, and returns
+// them in the order that they are saved in
+func editOrder(current []string) ([]string, error) {
+	file, err := os.CreateTemp("", "gh-diff-reorder-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	var contents strings.Builder
+	for _, commit := range current {
+		id, err := diffIDFromCommit(commit)
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			id = "-"
+		}
+		d := &diff{commit: commit}
+		contents.WriteString(fmt.Sprintf("%.7s %s %s\n", commit, id, d.getSubject()))
+	}
+	contents.WriteString(
+		"\n# Reorder the lines to reorder the diffs. The oldest commit is first.\n" +
+			"# Every commit has to stay in the list.\n",
+	)
+	_, err = file.WriteString(contents.String())
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	editor := mustCommand(exec.Command("git", "var", "GIT_EDITOR"), true, false)
+	_, err = runCommand(
+		exec.Command("sh", "-c", fmt.Sprintf("%s \"$1\"", editor), "--", file.Name()),
+		false,
+		false,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := os.Open(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer edited.Close()
+
+	order := []string{}
+	scanner := bufio.NewScanner(edited)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		commit, err := runCommand(
+			exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^{commit}", fields[0])),
+			true,
+			false,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unknown commit: %s", fields[0])
+		}
+		order = append(order, commit)
+	}
+
+	return order, scanner.Err()
+}
@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// getDiffIndex maps the Diff-Id trailer of every commit between the default
+// branch and the tip of the current branch to the commits that have it
+func (c *Diffclient) getDiffIndex() (map[string][]string, error) {
+	output, err := exec.Command(
+		"git",
+		"log",
+		"--format=%H%x09%(trailers:key=Diff-Id,key=DiffID,valueonly,separator=%x2C)",
+		fmt.Sprintf("origin/%s..%s", c.config.DefaultBranch, branchTip()),
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list commits: %v", err)
+	}
+
+	index := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, id := range strings.Split(parts[1], ",") {
+			id = strings.TrimSpace(id)
+			if id != "" {
+				index[id] = append(index[id], parts[0])
+			}
+		}
+	}
+
+	return index, nil
+}
+
+// resolveDiff finds the diff that a reference on the command line refers to.
+// The reference can be a Diff-Id, a PR number (#123), the branch of a diff, a
+// revision (a SHA, HEAD~2 etc) or @ for HEAD.
+func (c *Diffclient) resolveDiff(ctx context.Context, ref string) (*diff, error) {
+	commit, err := c.resolveCommit(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return newDiffFromCommit(ctx, commit)
+}
+
+// resolveCommit returns the local commit for a reference to a diff. It's an
+// error if the reference could mean more than one commit.
+func (c *Diffclient) resolveCommit(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("no diff given")
+	}
+	if ref == "@" {
+		ref = "HEAD"
+	}
+
+	index, err := c.getDiffIndex()
+	if err != nil {
+		return "", err
+	}
+
+	// localCommit returns the commit in the current branch for a Diff-Id
+	localCommit := func(id string) (string, error) {
+		commits := index[id]
+		switch len(commits) {
+		case 0:
+			return "", fmt.Errorf("diff %s isn't in the current branch", id)
+		case 1:
+			return commits[0], nil
+		}
+		return "", duplicateDiffIDError(id, commits)
+	}
+
+	if strings.HasPrefix(ref, "#") {
+		prNumber := strings.TrimPrefix(ref, "#")
+		if _, err := strconv.Atoi(prNumber); err != nil {
+			return "", fmt.Errorf("invalid PR number: %s", ref)
+		}
+		instance, err := c.db.getDiffByPrNumber(ctx, prNumber)
+		if err != nil {
+			return "", err
+		}
+		if instance == nil {
+			return "", fmt.Errorf("no diff has PR %s", ref)
+		}
+		return localCommit(instance.ID)
+	}
+
+	// matches maps each commit the ref could mean to how it matched
+	matches := map[string][]string{}
+	// notFound is the reason the ref didn't match anything, if it's a diff
+	// that isn't in the current branch
+	var notFound error
+
+	match := func(kind, id string) error {
+		commit, err := localCommit(id)
+		if err != nil {
+			return err
+		}
+		matches[commit] = append(matches[commit], kind)
+		return nil
+	}
+
+	if _, ok := index[ref]; ok {
+		if err := match("Diff-Id", ref); err != nil {
+			return "", err
+		}
+	} else {
+		instance, err := c.db.getDiff(ctx, ref)
+		if err != nil {
+			return "", err
+		}
+		if instance != nil {
+			notFound = fmt.Errorf("diff %s isn't in the current branch", ref)
+		}
+	}
+
+	instance, err := c.db.getDiffByBranch(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if instance != nil {
+		if err := match("branch", instance.ID); err != nil {
+			notFound = err
+		}
+	}
+
+	sha, err := exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^{commit}", ref)).Output()
+	if err == nil {
+		commit := strings.TrimSpace(string(sha))
+		// A ref to the pushed version of a diff means the local commit
+		id, err := diffIDFromCommit(commit)
+		if err != nil {
+			return "", err
+		}
+		switch commits := index[id]; len(commits) {
+		case 0:
+		case 1:
+			commit = commits[0]
+		default:
+			return "", duplicateDiffIDError(id, commits)
+		}
+		matches[commit] = append(matches[commit], "revision")
+	}
+
+	switch len(matches) {
+	case 0:
+		if notFound != nil {
+			return "", notFound
+		}
+		return "", fmt.Errorf("can't find a diff for %q", ref)
+	case 1:
+		for commit := range matches {
+			return commit, nil
+		}
+	}
+
+	commits := make([]string, 0, len(matches))
+	for commit := range matches {
+		commits = append(commits, commit)
+	}
+	sort.Strings(commits)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q is ambiguous, it could mean:\n", ref)
+	for _, commit := range commits {
+		d := &diff{commit: commit}
+		fmt.Fprintf(
+			&b, "  %.7s %s (%s)\n",
+			commit, d.getSubject(), strings.Join(matches[commit], ", "),
+		)
+	}
+	b.WriteString("use a full commit SHA or the diff's PR number instead")
+	return "", errors.New(b.String())
+}
@@ -0,0 +1,203 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// revisionRef is the hidden ref that a revision of a diff is pushed to so
+// that it isn't lost when the branch is force pushed
+func revisionRef(diffID string, number int) string {
+	return fmt.Sprintf("refs/diffs/%s/%d", diffID, number)
+}
+
+// recordRevision saves the version of the diff that was just pushed to the
+// branch as a new revision
+func (d *diff) recordRevision(ctx context.Context, branchName, baseRef string) error {
+	commit := mustCommand(
+		exec.Command("git", "rev-parse", branchName),
+		true,
+		false,
+	)
+
+	revisions, err := client.db.getRevisions(ctx, d.id)
+	if err != nil {
+		return err
+	}
+
+	number := 1
+	var previous *dbrevision
+	if len(revisions) > 0 {
+		previous = revisions[len(revisions)-1]
+		// Nothing has changed since the last sync
+		if previous.Commit == commit {
+			return nil
+		}
+		number = previous.Number + 1
+	}
+
+	base := mustCommand(
+		exec.Command("git", "rev-parse", baseRef),
+		true,
+		false,
+	)
+
+	ref := revisionRef(d.id, number)
+	mustCommand(
+		exec.Command("git", "update-ref", ref, commit),
+		true,
+		false,
+	)
+	_, err = runCommand(
+		exec.Command("git", "push", "origin", fmt.Sprintf("%s:%s", ref, ref)),
+		true,
+		false,
+	)
+	if err != nil {
+		// The revision is still available locally so don't fail the sync
+		fmt.Printf("unable to push revision %d to %s: %v\n", number, ref, err)
+	}
+
+	patchID, err := d.git.getPatchID(commit)
+	if err != nil {
+		return err
+	}
+	revision := &dbrevision{
+		DiffID:    d.id,
+		Number:    number,
+		Commit:    commit,
+		PatchID:   patchID,
+		Base:      base,
+		CreatedAt: time.Now(),
+	}
+	err = client.db.createRevision(ctx, revision)
+	if err != nil {
+		return err
+	}
+
+	if client.config.RevisionComments && previous != nil && d.prNumber != "" {
+		fmt.Printf("commenting on PR #%s\n", d.prNumber)
+		comment, err := d.revisionComment(previous, revision)
+		if err == nil {
+			err = addPRComment(d.prNumber, comment)
+		}
+		if err != nil {
+			// The sync itself has worked so don't fail because of the comment
+			fmt.Printf("unable to comment on PR #%s: %v\n", d.prNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// changedFiles returns the files whose changes are different between two
+// commits of a diff
+func (d *diff) changedFiles(oldCommit, newCommit string) ([]string, error) {
+	oldPatches, err := d.git.getFilePatches(oldCommit)
+	if err != nil {
+		return nil, err
+	}
+	newPatches, err := d.git.getFilePatches(newCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for file, patch := range newPatches {
+		if old, ok := oldPatches[file]; !ok || stripHunkHeaders(old) != stripHunkHeaders(patch) {
+			files = append(files, file)
+		}
+	}
+	for file := range oldPatches {
+		if _, ok := newPatches[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// revisionComment is the PR comment posted when a new revision is synced
+func (d *diff) revisionComment(previous, revision *dbrevision) (string, error) {
+	repoURL := mustCommand(
+		exec.Command("gh", "repo", "view", "--json=url", "--jq=.url"),
+		true,
+		false,
+	)
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf(
+		"**Revision %d** synced (%.7s → %.7s)\n\n",
+		revision.Number, previous.Commit, revision.Commit,
+	))
+
+	files, err := d.changedFiles(previous.Commit, revision.Commit)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		body.WriteString(fmt.Sprintf(
+			"No changes to files since revision %d (rebase or commit message only)\n\n",
+			previous.Number,
+		))
+	} else {
+		body.WriteString(fmt.Sprintf("Files changed since revision %d:\n", previous.Number))
+		for _, file := range files {
+			body.WriteString(fmt.Sprintf("- `%s`\n", file))
+		}
+		body.WriteString("\n")
+	}
+
+	body.WriteString(fmt.Sprintf(
+		"[Compare with revision %d](%s/compare/%s..%s)\n",
+		previous.Number, repoURL, previous.Commit, revision.Commit,
+	))
+
+	return body.String(), nil
+}
+
+// getRevisionCommit returns the commit of a revision, fetching the hidden ref
+// from the remote if it doesn't exist locally
+func (d *diff) getRevisionCommit(ctx context.Context, number int) (string, error) {
+	revision, err := client.db.getRevision(ctx, d.id, number)
+	if err != nil {
+		return "", err
+	}
+	if revision == nil {
+		return "", fmt.Errorf("diff %s doesn't have a revision %d", d.id, number)
+	}
+
+	_, err = runCommand(
+		exec.Command("git", "cat-file", "-e", revision.Commit),
+		true,
+		false,
+	)
+	if err != nil {
+		ref := revisionRef(d.id, number)
+		_, err = runCommand(
+			exec.Command("git", "fetch", "origin", fmt.Sprintf("%s:%s", ref, ref)),
+			true,
+			false,
+		)
+		if err != nil {
+			return "", fmt.Errorf("unable to fetch revision %d: %v", number, err)
+		}
+	}
+
+	return revision.Commit, nil
+}
+
+// parseRevisionNumber parses a revision number argument
+func parseRevisionNumber(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("invalid revision: %s", value)
+	}
+	return number, nil
+}
@@ -0,0 +1,613 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// SplitOptions change how a diff is split
+type SplitOptions struct {
+	// Files splits the diff by file instead of by hunk
+	Files bool
+}
+
+// splitUnit is a change that can be moved into one of the parts of a split:
+// either a single hunk or a whole file. Files that are added, deleted,
+// renamed, binary or only change mode can't be split into hunks.
+type splitUnit struct {
+	file string
+	// header is the diff --git, --- and +++ lines of the file
+	header string
+	// paths are the paths that a whole file unit changes
+	paths []string
+	// hunk is the @@ line and the changed lines of a hunk unit
+	hunk     string
+	oldStart int
+	oldCount int
+	newStart int
+	newCount int
+	// offset is the line offset of the hunk in the original patch that isn't
+	// caused by the hunks before it
+	offset int
+	label  string
+}
+
+func (u *splitUnit) isWholeFile() bool {
+	return u.hunk == ""
+}
+
+func (u *splitUnit) delta() int {
+	return u.newCount - u.oldCount
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseSplitUnits splits the patch of a commit up into the units that can be
+// moved between parts
+func parseSplitUnits(patch string, byFile bool) ([]*splitUnit, error) {
+	var units []*splitUnit
+	var filePatches []string
+	var current strings.Builder
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "diff --git ") && current.Len() > 0 {
+			filePatches = append(filePatches, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		filePatches = append(filePatches, current.String())
+	}
+
+	for _, filePatch := range filePatches {
+		lines := strings.Split(strings.TrimSuffix(filePatch, "\n"), "\n")
+		// diff --git a/<file> b/<file>
+		parts := strings.SplitN(lines[0], " b/", 2)
+		file := parts[len(parts)-1]
+		paths := []string{file}
+
+		wholeFile := byFile
+		var header strings.Builder
+		idx := 0
+		for ; idx < len(lines) && !strings.HasPrefix(lines[idx], "@@"); idx++ {
+			line := lines[idx]
+			switch {
+			case strings.HasPrefix(line, "rename from "):
+				paths = append(paths, strings.TrimPrefix(line, "rename from "))
+				wholeFile = true
+			case strings.HasPrefix(line, "new file mode"),
+				strings.HasPrefix(line, "deleted file mode"),
+				strings.HasPrefix(line, "old mode"),
+				strings.HasPrefix(line, "copy from"),
+				strings.HasPrefix(line, "Binary files"):
+				wholeFile = true
+			}
+			header.WriteString(line)
+			header.WriteString("\n")
+		}
+		if idx == len(lines) {
+			wholeFile = true
+		}
+
+		if wholeFile {
+			units = append(units, &splitUnit{
+				file:   file,
+				header: header.String(),
+				paths:  paths,
+				label:  fmt.Sprintf("%s (whole file)", file),
+			})
+			continue
+		}
+
+		// the offset of each hunk relative to the hunks before it
+		delta := 0
+		var unit *splitUnit
+		// hunks are labelled with their first changed line
+		summarised := false
+		for ; idx < len(lines); idx++ {
+			line := lines[idx]
+			if strings.HasPrefix(line, "@@") {
+				match := hunkHeader.FindStringSubmatch(line)
+				if match == nil {
+					return nil, fmt.Errorf("can't parse hunk header: %s", line)
+				}
+				unit = &splitUnit{
+					file:     file,
+					header:   header.String(),
+					oldStart: atoiDefault(match[1], 1),
+					oldCount: atoiDefault(match[2], 1),
+					newStart: atoiDefault(match[3], 1),
+					newCount: atoiDefault(match[4], 1),
+				}
+				unit.offset = unit.newStart - unit.oldStart - delta
+				delta += unit.delta()
+				unit.label = fmt.Sprintf("%s %s", file, hunkHeader.FindString(line))
+				units = append(units, unit)
+				summarised = false
+			} else if !summarised && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) {
+				summary := strings.TrimSpace(line[1:])
+				if len(summary) > 50 {
+					summary = summary[:50] + "…"
+				}
+				if summary != "" {
+					unit.label = fmt.Sprintf("%s %s", unit.label, summary)
+					summarised = true
+				}
+			}
+			unit.hunk += line + "\n"
+		}
+	}
+
+	return units, nil
+}
+
+func atoiDefault(value string, fallback int) int {
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// splitPatch builds a patch of the hunks of a part that applies on top of the
+// hunks that have already been applied by the parts before it. The line
+// numbers of each hunk are moved by the hunks of the same file that have been
+// applied so far.
+func splitPatch(part []*splitUnit, applied []*splitUnit) string {
+	var patch strings.Builder
+	var lastFile string
+	// the offset of each hunk caused by the hunks before it in this patch
+	partDelta := 0
+	for _, unit := range part {
+		if unit.isWholeFile() {
+			continue
+		}
+		if unit.file != lastFile {
+			patch.WriteString(unit.header)
+			lastFile = unit.file
+			partDelta = 0
+		}
+
+		oldStart := unit.oldStart
+		for _, other := range applied {
+			if !other.isWholeFile() && other.file == unit.file && other.oldStart < unit.oldStart {
+				oldStart += other.delta()
+			}
+		}
+		newStart := oldStart + partDelta + unit.offset
+		partDelta += unit.delta()
+
+		lines := strings.SplitN(unit.hunk, "\n", 2)
+		patch.WriteString(fmt.Sprintf(
+			"@@ -%d,%d +%d,%d @@\n",
+			oldStart, unit.oldCount, newStart, unit.newCount,
+		))
+		patch.WriteString(lines[1])
+	}
+	return patch.String()
+}
+
+// SplitDiff splits a diff into several diffs. The changes of the diff are
+// partitioned interactively, each part becomes a new commit with a new
+// Diff-Id and one of the parts keeps the diff's Diff-Id (and so its branch
+// and PR). Commits on top of the diff are rebased onto the new commits. If
+// the diff has been synced the new diffs are synced too so that they form a
+// stack in its place.
+func (c *Diffclient) SplitDiff(ctx context.Context, ref string, opts SplitOptions) error {
+	if err := checkCanRewrite(); err != nil {
+		return err
+	}
+
+	d, err := c.resolveDiff(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	parentCommit, err := runCommand(
+		exec.Command("git", "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^", d.commit)),
+		true,
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("can't split the root commit")
+	}
+
+	// The commits on top of the diff are rebased onto the new commits so the
+	// diff has to be in HEAD's history
+	_, rebaseCommits, err := rebaseRange(d.commit)
+	if err != nil {
+		return err
+	}
+	if len(rebaseCommits) == 0 || rebaseCommits[0] != d.commit {
+		return fmt.Errorf("diff %s isn't below HEAD so it can't be split", d.id)
+	}
+
+	patch, err := d.git.getPatch(d.commit, parentCommit)
+	if err != nil {
+		return err
+	}
+	units, err := parseSplitUnits(patch, opts.Files)
+	if err != nil {
+		return err
+	}
+	if len(units) < 2 {
+		return fmt.Errorf("diff %s only has one change so it can't be split", d.id)
+	}
+
+	fmt.Printf("splitting diff: %s (%s) with %d changes\n", d.getSubject(), d.id, len(units))
+
+	parts, err := askSplitParts(units)
+	if err != nil {
+		return err
+	}
+
+	keeper, err := askSplitKeeper(d, len(parts))
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(parts))
+	used := map[string]bool{}
+	for idx := range parts {
+		if idx == keeper {
+			ids[idx] = d.id
+			continue
+		}
+		// The ids aren't in any commits yet so make sure that they are unique
+		// amongst themselves too
+		for ids[idx] == "" || used[ids[idx]] {
+			ids[idx], err = c.newDiffID(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		used[ids[idx]] = true
+	}
+
+	messages := make([]string, len(parts))
+	for idx := range parts {
+		if idx == keeper {
+			messages[idx] = mustCommand(
+				exec.Command("git", "show", "-s", "--format=%B", d.commit),
+				true,
+				false,
+			)
+			continue
+		}
+		subject := fmt.Sprintf("%s (%d/%d)", d.getSubject(), idx+1, len(parts))
+		err := askOne(&survey.Input{
+			Message: fmt.Sprintf("Subject of diff %d:", idx+1),
+			Default: subject,
+		}, &subject)
+		if err != nil {
+			return err
+		}
+		messages[idx] = fmt.Sprintf("%s\n\nDiff-Id: %s\n", subject, ids[idx])
+	}
+
+	commits, err := commitSplitParts(d.commit, parentCommit, parts, messages)
+	if err != nil {
+		return err
+	}
+
+	// Replay the commits on top of the diff onto the last part
+	todo := []string{}
+	for _, commit := range rebaseCommits[1:] {
+		todo = append(todo, fmt.Sprintf("pick %s", commit))
+	}
+	if len(todo) == 0 {
+		todo = append(todo, "noop")
+	}
+	err = runRebase(commits[len(commits)-1], todo)
+	if err != nil {
+		return err
+	}
+
+	for idx, commit := range commits {
+		note := ""
+		if idx == keeper {
+			note = " (original)"
+		}
+		fmt.Printf("%.7s %s → Diff-Id: %s%s\n", commit, (&diff{commit: commit}).getSubject(), ids[idx], note)
+	}
+	fmt.Printf("split diff %s into %d diffs\n", d.id, len(parts))
+
+	if d.isSaved() {
+		return c.syncSplit(ctx, d, ids, keeper)
+	}
+
+	return nil
+}
+
+// syncSplit syncs the parts of a saved diff that has been split, bottom up,
+// so that they form a stack in place of the diff. The part that kept the
+// diff's id is stacked on the part below it and the diffs that were stacked
+// on the original diff are moved onto the top part.
+func (c *Diffclient) syncSplit(ctx context.Context, d *diff, ids []string, keeper int) error {
+	// Load the children before the keeper is restacked
+	children, err := c.db.getChildDiffs(ctx, d.id)
+	if err != nil {
+		return err
+	}
+
+	for idx, id := range ids {
+		if idx != keeper {
+			// The bottom part takes the place of the original diff in its
+			// stack and every other part is stacked on the part below it
+			opts := SyncOptions{SkipDependants: true, Stacking: StackingStack}
+			if idx == 0 && d.externalBranch != "" {
+				opts.Onto = d.externalBranch
+			} else if idx == 0 && d.parentDiffID == "" {
+				opts.Stacking = StackingNoStack
+			}
+			err = c.SyncDiff(ctx, id, opts)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if idx > 0 {
+			fmt.Printf("restacking %s onto %s\n", d.id, ids[idx-1])
+			err = c.db.updateStackedOn(ctx, d.id, ids[idx-1])
+			if err != nil {
+				return err
+			}
+			err = c.db.updateExternalParent(ctx, d.id, "", "")
+			if err != nil {
+				return err
+			}
+		}
+		err = c.SyncDiff(ctx, d.id, SyncOptions{SkipDependants: true})
+		if err != nil {
+			return err
+		}
+		if idx > 0 && d.prNumber != "" {
+			below, err := newDiffFromID(ctx, ids[idx-1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("retargeting PR #%s onto %s\n", d.prNumber, below.branch)
+			mustCommand(
+				exec.Command("gh", "pr", "edit", d.prNumber, "--base", below.branch),
+				true,
+				false,
+			)
+		}
+	}
+
+	top, err := newDiffFromID(ctx, ids[len(ids)-1])
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if top.id != d.id {
+			fmt.Printf("restacking %s onto %s\n", child.ID, top.id)
+			err = c.db.updateStackedOn(ctx, child.ID, top.id)
+			if err != nil {
+				return err
+			}
+			if child.PRNumber != "" {
+				fmt.Printf("retargeting PR #%s onto %s\n", child.PRNumber, top.branch)
+				mustCommand(
+					exec.Command("gh", "pr", "edit", child.PRNumber, "--base", top.branch),
+					true,
+					false,
+				)
+			}
+		}
+		err = c.SyncDiff(ctx, child.ID, SyncOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitSplitParts creates a commit for each part on top of parent and
+// returns them in order. The commits are built in a temporary index so the
+// working tree isn't touched.
+func commitSplitParts(original, parent string, parts [][]*splitUnit, messages []string) ([]string, error) {
+	indexFile, err := os.CreateTemp("", "gh-diff-index-")
+	if err != nil {
+		return nil, err
+	}
+	indexFile.Close()
+	defer os.Remove(indexFile.Name())
+
+	gitEnv := func(args ...string) *exec.Cmd {
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_INDEX_FILE=%s", indexFile.Name()))
+		return cmd
+	}
+
+	_, err = runCommand(gitEnv("read-tree", parent), true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	author := mustCommand(
+		exec.Command("git", "show", "-s", "--format=%an%x00%ae%x00%aI", original),
+		true,
+		false,
+	)
+	authorParts := strings.Split(author, "\x00")
+
+	var commits []string
+	var applied []*splitUnit
+	for idx, part := range parts {
+		for _, unit := range part {
+			if !unit.isWholeFile() {
+				continue
+			}
+			for _, path := range unit.paths {
+				err = splitCheckoutPath(gitEnv, original, path)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if patch := splitPatch(part, applied); patch != "" {
+			applyCmd := gitEnv("apply", "--cached", "--unidiff-zero", "-")
+			applyCmd.Stdin = strings.NewReader(patch)
+			_, err = runCommand(applyCmd, true, false)
+			if err != nil {
+				return nil, fmt.Errorf("unable to apply the changes of diff %d: %v", idx+1, err)
+			}
+		}
+		applied = append(applied, part...)
+
+		tree, err := runCommand(gitEnv("write-tree"), true, false)
+		if err != nil {
+			return nil, err
+		}
+
+		commitCmd := exec.Command("git", "commit-tree", tree, "-p", parent, "-F", "-")
+		commitCmd.Stdin = strings.NewReader(messages[idx])
+		commitCmd.Env = append(
+			os.Environ(),
+			fmt.Sprintf("GIT_AUTHOR_NAME=%s", authorParts[0]),
+			fmt.Sprintf("GIT_AUTHOR_EMAIL=%s", authorParts[1]),
+			fmt.Sprintf("GIT_AUTHOR_DATE=%s", authorParts[2]),
+		)
+		commit, err := runCommand(commitCmd, true, false)
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, commit)
+		parent = commit
+	}
+
+	// Every change has been used so the last part has to end up with the
+	// same files as the original commit
+	lastTree := mustCommand(exec.Command("git", "rev-parse", fmt.Sprintf("%s^{tree}", parent)), true, false)
+	originalTree := mustCommand(exec.Command("git", "rev-parse", fmt.Sprintf("%s^{tree}", original)), true, false)
+	if lastTree != originalTree {
+		return nil, fmt.Errorf("the split diffs don't add up to the original diff")
+	}
+
+	return commits, nil
+}
+
+// splitCheckoutPath sets a path in the index to its version in commit,
+// removing it if it doesn't exist there
+func splitCheckoutPath(gitEnv func(args ...string) *exec.Cmd, commit, path string) error {
+	entry, err := runCommand(exec.Command("git", "ls-tree", commit, "--", path), true, false)
+	if err != nil {
+		return err
+	}
+	if entry == "" {
+		_, err = runCommand(gitEnv("update-index", "--force-remove", "--", path), true, false)
+		return err
+	}
+
+	// ls-tree output is in the same format that --index-info reads
+	updateCmd := gitEnv("update-index", "--index-info")
+	updateCmd.Stdin = strings.NewReader(entry + "\n")
+	_, err = runCommand(updateCmd, true, false)
+	return err
+}
+
+// askSplitParts asks how many parts to split the changes into and which
+// changes go into each part. The last part gets whatever is left.
+func askSplitParts(units []*splitUnit) ([][]*splitUnit, error) {
+	count := "2"
+	err := askOne(&survey.Input{
+		Message: "How many diffs should it be split into?",
+		Default: count,
+	}, &count, survey.WithValidator(func(ans interface{}) error {
+		n, err := strconv.Atoi(ans.(string))
+		if err != nil || n < 2 || n > len(units) {
+			return fmt.Errorf("enter a number from 2 to %d", len(units))
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(count)
+
+	remaining := units
+	var parts [][]*splitUnit
+	for len(parts) < n-1 {
+		options := make([]string, len(remaining))
+		for idx, unit := range remaining {
+			options[idx] = fmt.Sprintf("%d. %s", idx+1, unit.label)
+		}
+
+		var selected []int
+		err := askOne(&survey.MultiSelect{
+			Message:  fmt.Sprintf("Changes for diff %d of %d:", len(parts)+1, n),
+			Options:  options,
+			PageSize: 15,
+		}, &selected)
+		if err != nil {
+			return nil, err
+		}
+		// Every part after this one needs at least one change
+		if len(selected) == 0 || len(remaining)-len(selected) < n-len(parts)-1 {
+			fmt.Printf("choose between 1 and %d changes\n", len(remaining)-(n-len(parts)-1))
+			continue
+		}
+
+		chosen := map[int]bool{}
+		for _, idx := range selected {
+			chosen[idx] = true
+		}
+		var part, rest []*splitUnit
+		for idx, unit := range remaining {
+			if chosen[idx] {
+				part = append(part, unit)
+			} else {
+				rest = append(rest, unit)
+			}
+		}
+		parts = append(parts, part)
+		remaining = rest
+	}
+	parts = append(parts, remaining)
+
+	for idx, part := range parts {
+		fmt.Printf("diff %d:\n", idx+1)
+		for _, unit := range part {
+			fmt.Printf("  %s\n", unit.label)
+		}
+	}
+
+	return parts, nil
+}
+
+// askSplitKeeper asks which part keeps the Diff-Id of the diff. It defaults to
+// the last part.
+func askSplitKeeper(d *diff, count int) (int, error) {
+	name := d.id
+	if d.prNumber != "" {
+		name = fmt.Sprintf("%s (#%s)", d.id, d.prNumber)
+	}
+
+	options := make([]string, count)
+	for idx := range options {
+		options[idx] = fmt.Sprintf("diff %d", idx+1)
+	}
+	var keeper int
+	err := askOne(&survey.Select{
+		Message: fmt.Sprintf("Which diff keeps %s?", name),
+		Options: options,
+		Default: options[count-1],
+	}, &keeper)
+	return keeper, err
+}
@@ -1,6 +1,7 @@
 package diff
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -76,6 +77,23 @@ func runCommand(cmd *exec.Cmd, capture bool, verbose bool) (string, error) {
 	return string(out), nil
 }
 
+// commandOutput runs a command and returns its output without printing
+// anything, so that it's safe to use while the dashboard is running. The error
+// includes the first line that the command wrote to stderr.
+func commandOutput(cmd *exec.Cmd) (string, error) {
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			// The first line is the error, git follows it with hints
+			stderr := strings.SplitN(strings.TrimSpace(string(exitErr.Stderr)), "\n", 2)
+			return "", fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), stderr[0])
+		}
+		return "", fmt.Errorf("%s: %v", strings.Join(cmd.Args, " "), err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
 func mustCommand(cmd *exec.Cmd, capture bool, verbose bool) string {
 	output, err := runCommand(cmd, capture, verbose)
 	check(err)
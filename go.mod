@@ -10,7 +10,9 @@ require (
 	github.com/charmbracelet/lipgloss v0.5.0
 	github.com/cli/go-gh v0.0.1
 	github.com/go-git/go-git/v5 v5.4.2
+	github.com/itchyny/gojq v0.12.7
 	github.com/jmoiron/sqlx v1.3.4
+	github.com/mattn/go-isatty v0.0.14
 	github.com/mattn/go-sqlite3 v1.14.9
 	github.com/shurcooL/githubv4 v0.0.0-20220520033151-0b4e3294ff00
 	github.com/shurcooL/graphql v0.0.0-20220606043923-3cf50f8a0a29 // indirect
@@ -0,0 +1,15 @@
+// Package hooks contains the git hooks that gh-diff installs
+package hooks
+
+import (
+	_ "embed" // for the hook scripts
+)
+
+// CommitMsg is the commit-msg hook that adds a Diff-Id trailer to commits
+//
+//go:embed commit-msg
+var CommitMsg []byte
+
+// Marker is in every hook installed by gh-diff so that they can be updated
+// without being chained to themselves
+const Marker = "gh-diff commit-msg hook"
@@ -8,7 +8,6 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/jkimbo/gh-diff/diff"
-	"github.com/jkimbo/gh-diff/tui"
 	"github.com/spf13/cobra"
 )
 
@@ -22,59 +21,44 @@ func check(err error) {
 	}
 }
 
+// setupClient creates a client with the DB and config loaded
+func setupClient(ctx context.Context) *diff.Diffclient {
+	c := diff.NewClient()
+	// TODO check that init has been run
+	err := c.Setup(ctx)
+	check(err)
+	return c
+}
+
 var rootCmd = &cobra.Command{
-	Use:   "gh-diff <commit_sha>",
+	Use:   "gh-diff [<diff>]",
 	Short: "Stacked diffs 📚",
-	Run: func(cmd *cobra.Command, args []string) {
-		var err error
-		// TODO check that init has been run
+	Long: `Stacked diffs 📚
 
-		ctx := context.Background()
+With no arguments the dashboard is shown. Passing a diff is a shorthand for
+"gh diff sync <diff>".
 
-		c := diff.NewClient()
+A <diff> can be given as a Diff-Id, a PR number (#123), the diff's branch, a
+commit or revision (HEAD~2) or @ for the current commit.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeDiffs,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if debug, _ := cmd.Flags().GetBool("debug"); debug {
+			os.Setenv("GH_DIFF_DEBUG", "1")
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := setupClient(ctx)
 
 		if len(args) == 0 {
-			// TODO list recent diffs
-			err = c.Setup(ctx)
+			err := c.Dashboard(ctx)
 			check(err)
-			commit, action, err := c.Dashboard(ctx)
-			check(err)
-
-			if commit != "" {
-				switch action {
-				case tui.Sync:
-					err = c.SyncDiff(ctx, commit)
-					check(err)
-				case tui.Land:
-					err = c.LandDiff(ctx, commit)
-					check(err)
-				}
-				return
-			}
-
 			return
 		}
 
-		commit := args[0]
-
-		switch commit {
-		case "init":
-			err = c.Init(ctx)
-			check(err)
-		case "land":
-			err = c.Setup(ctx)
-			check(err)
-			commit = args[1]
-			err = c.LandDiff(ctx, commit)
-			check(err)
-		default:
-			err = c.Setup(ctx)
-			check(err)
-			err = c.SyncDiff(ctx, commit)
-			check(err)
-		}
-
-		return
+		err := c.SyncDiff(ctx, args[0], diff.SyncOptions{})
+		check(err)
 	},
 }
 
@@ -85,7 +69,6 @@ func main() {
 	}
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
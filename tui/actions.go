@@ -0,0 +1,196 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ActionState is the state of a dashboard action on an item
+type ActionState int
+
+const (
+	ActionNone ActionState = iota
+	ActionQueued
+	ActionRunning
+	ActionSucceeded
+	ActionFailed
+)
+
+// Runner runs dashboard actions
+type Runner interface {
+	// ActionCommand returns the command that performs the action on the item.
+	// The command is run in the background with its output shown in the log
+	// pane.
+	ActionCommand(action DashboardAction, item Item) *exec.Cmd
+	// ReorderCommand returns the command that reorders the local commits into
+	// order (oldest first)
+	ReorderCommand(order []string) *exec.Cmd
+}
+
+// Backend is everything the dashboard needs to load and act on diffs
+type Backend interface {
+	Loader
+	DetailLoader
+	Runner
+}
+
+type queuedAction struct {
+	action DashboardAction
+	// id is the Diff-Id of the item. Commits change when diffs are synced or
+	// landed so they can't be used to find the item again.
+	id string
+	// commit is used to find items that don't have a Diff-Id yet
+	commit string
+	// order is the new order of the commits for a reorder
+	order []string
+}
+
+// find returns the index of the item that the action is for or -1 if it can't
+// be found
+func (qa queuedAction) find(items []Item) int {
+	if qa.id == "" {
+		return findItem(items, qa.commit)
+	}
+	return findItemByID(items, qa.id)
+}
+
+// command returns the command that runs the action
+func (qa queuedAction) command(runner Runner, item Item) *exec.Cmd {
+	if qa.action == Reorder {
+		return runner.ReorderCommand(qa.order)
+	}
+	return runner.ActionCommand(qa.action, item)
+}
+
+// target describes the item that the action is for in the log
+func (qa queuedAction) target() string {
+	if qa.id == "" {
+		return fmt.Sprintf("%.7s", qa.commit)
+	}
+	return qa.id
+}
+
+type actionRun struct {
+	queuedAction
+	lines chan string
+	done  chan error
+}
+
+type actionOutputMsg struct {
+	line string
+}
+
+type actionDoneMsg struct {
+	err error
+}
+
+func (a DashboardAction) String() string {
+	switch a {
+	case Land:
+		return "land"
+	case Abandon:
+		return "abandon"
+	case Adopt:
+		return "adopt"
+	case Reorder:
+		return "reorder"
+	default:
+		return "sync"
+	}
+}
+
+// progressive returns the "-ing" form of the action e.g. syncing
+func (a DashboardAction) progressive() string {
+	switch a {
+	case Land:
+		return "landing"
+	case Abandon:
+		return "abandoning"
+	case Adopt:
+		return "adopting"
+	case Reorder:
+		return "reordering"
+	default:
+		return "syncing"
+	}
+}
+
+func (a DashboardAction) pastTense() string {
+	switch a {
+	case Land:
+		return "landed"
+	case Abandon:
+		return "abandoned"
+	case Adopt:
+		return "adopted"
+	case Reorder:
+		return "reordered"
+	default:
+		return "synced"
+	}
+}
+
+// startAction starts the command and streams its combined output line by
+// line
+func startAction(qa queuedAction, cmd *exec.Cmd) (*actionRun, error) {
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	run := &actionRun{
+		queuedAction: qa,
+		lines:        make(chan string),
+		done:         make(chan error, 1),
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			// progress output from git uses carriage returns to redraw the
+			// line so only keep the last part
+			parts := strings.Split(scanner.Text(), "\r")
+			run.lines <- parts[len(parts)-1]
+		}
+		close(run.lines)
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		writer.Close()
+		run.done <- err
+	}()
+
+	return run, nil
+}
+
+// waitForActionOutput returns the next line of output from the action or an
+// actionDoneMsg once the command has exited
+func waitForActionOutput(run *actionRun) tea.Cmd {
+	return func() tea.Msg {
+		line, ok := <-run.lines
+		if !ok {
+			return actionDoneMsg{err: <-run.done}
+		}
+		return actionOutputMsg{line: line}
+	}
+}
+
+// findItemByID returns the index of the item for a Diff-Id or -1 if it can't
+// be found
+func findItemByID(items []Item, id string) int {
+	for idx, i := range items {
+		if i.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
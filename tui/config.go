@@ -0,0 +1,275 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// Config customises the keys and colors of the dashboard. It's the tui
+// section of the config file.
+type Config struct {
+	// Preset is the set of keys to start from: default, vim or emacs
+	Preset string `yaml:"preset,omitempty"`
+	// Keys remaps bindings by name, e.g. sync: [S, ctrl+s]
+	Keys map[string]Keys `yaml:"keys,omitempty"`
+	// Colors overrides the colors of styles by name, e.g. diff_add: "#00ff00"
+	Colors map[string]string `yaml:"colors,omitempty"`
+}
+
+// Keys is the list of keys for a binding. It can be written in the config as
+// a single key or a list of keys.
+type Keys []string
+
+func (k *Keys) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*k = Keys{value.Value}
+		return nil
+	}
+	var keys []string
+	if err := value.Decode(&keys); err != nil {
+		return err
+	}
+	*k = keys
+	return nil
+}
+
+// Merge returns the config with any settings from override applied on top
+func (c Config) Merge(override Config) Config {
+	merged := Config{
+		Preset: c.Preset,
+		Keys:   map[string]Keys{},
+		Colors: map[string]string{},
+	}
+	if override.Preset != "" {
+		merged.Preset = override.Preset
+	}
+	for _, keys := range []map[string]Keys{c.Keys, override.Keys} {
+		for name, k := range keys {
+			merged.Keys[name] = k
+		}
+	}
+	for _, colors := range []map[string]string{c.Colors, override.Colors} {
+		for name, color := range colors {
+			merged.Colors[name] = color
+		}
+	}
+	return merged
+}
+
+// keyPresets change the bindings used to move around the list. Anything that
+// isn't in a preset uses the default keys.
+var keyPresets = map[string]map[string]Keys{
+	"default": {},
+	"vim": {
+		"cursor_up":   {"k", "up"},
+		"cursor_down": {"j", "down"},
+	},
+	"emacs": {
+		"cursor_up":   {"ctrl+p", "up"},
+		"cursor_down": {"ctrl+n", "down"},
+		"cancel":      {"ctrl+g", "esc"},
+	},
+}
+
+// keyGroups are the bindings that are active at the same time, so none of them
+// can share a key
+var keyGroups = []struct {
+	view  string
+	names []string
+}{
+	{"list", []string{
+		"cursor_up", "cursor_down", "enter", "interdiff", "select", "select_stack",
+		"sync", "land", "abandon", "adopt", "reorder", "refresh", "filter",
+		"only_needs_sync", "only_unsynced", "only_failing", "only_awaiting_review",
+		"cancel", "quit", "force_quit",
+	}},
+	{"confirm", []string{"confirm", "cancel", "force_quit"}},
+	{"reorder", []string{
+		"cursor_up", "cursor_down", "move_up", "move_down", "confirm", "cancel",
+		"force_quit",
+	}},
+}
+
+// NewKeyMapFromConfig creates the key map with the preset and any remapped
+// bindings from the config. It returns an error if a binding is unknown or
+// two bindings that are active at the same time share a key.
+func NewKeyMapFromConfig(config Config) (*KeyMap, error) {
+	keys := NewKeyMap()
+	bindings := keys.bindings()
+
+	preset := config.Preset
+	if preset == "" {
+		preset = "default"
+	}
+	presetKeys, ok := keyPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown tui preset %q (expected default, vim or emacs)", config.Preset)
+	}
+
+	var errs []string
+	for _, remapped := range []map[string]Keys{presetKeys, config.Keys} {
+		for name, k := range remapped {
+			binding, ok := bindings[name]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("unknown key binding %q", name))
+				continue
+			}
+			if len(k) == 0 {
+				errs = append(errs, fmt.Sprintf("key binding %q has no keys", name))
+				continue
+			}
+			rebind(binding, k)
+		}
+	}
+
+	errs = append(errs, keyConflicts(bindings)...)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("invalid tui keys:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	return keys, nil
+}
+
+// rebind changes the keys of a binding, keeping its help description
+func rebind(binding *key.Binding, keys Keys) {
+	help := keys[0]
+	if help == " " {
+		help = "space"
+	}
+	*binding = key.NewBinding(
+		key.WithKeys(keys...),
+		key.WithHelp(help, binding.Help().Desc),
+	)
+}
+
+// unbindListKeys removes the keys that are bound to something in the list view
+// from the list's own paging and help bindings so that remapping an action
+// onto one of them doesn't page the list as well
+func unbindListKeys(listKeys *list.KeyMap, keys *KeyMap) {
+	bindings := keys.bindings()
+	used := map[string]bool{}
+	for _, group := range keyGroups {
+		if group.view != "list" {
+			continue
+		}
+		for _, name := range group.names {
+			for _, k := range bindings[name].Keys() {
+				used[k] = true
+			}
+		}
+	}
+
+	for _, binding := range []*key.Binding{
+		&listKeys.PrevPage,
+		&listKeys.NextPage,
+		&listKeys.GoToStart,
+		&listKeys.GoToEnd,
+		&listKeys.ShowFullHelp,
+		&listKeys.CloseFullHelp,
+	} {
+		var remaining []string
+		for _, k := range binding.Keys() {
+			if !used[k] {
+				remaining = append(remaining, k)
+			}
+		}
+		if len(remaining) == len(binding.Keys()) {
+			continue
+		}
+		if len(remaining) == 0 {
+			binding.SetEnabled(false)
+			continue
+		}
+		*binding = key.NewBinding(
+			key.WithKeys(remaining...),
+			key.WithHelp(remaining[0], binding.Help().Desc),
+		)
+	}
+}
+
+// keyConflicts describes every key that is bound more than once in the same
+// view
+func keyConflicts(bindings map[string]*key.Binding) []string {
+	var conflicts []string
+	for _, group := range keyGroups {
+		boundTo := map[string][]string{}
+		for _, name := range group.names {
+			for _, k := range bindings[name].Keys() {
+				boundTo[k] = append(boundTo[k], name)
+			}
+		}
+		for k, names := range boundTo {
+			if len(names) > 1 {
+				conflicts = append(conflicts, fmt.Sprintf(
+					"%q is bound to %s in the %s view",
+					k, strings.Join(names, " and "), group.view,
+				))
+			}
+		}
+	}
+	return conflicts
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// validColor returns true for hex colors and ANSI color numbers
+func validColor(color string) bool {
+	if hexColor.MatchString(color) {
+		return true
+	}
+	n, err := strconv.Atoi(color)
+	return err == nil && n >= 0 && n <= 255
+}
+
+// newStyles creates the styles with any colors from the config
+func newStyles(config Config) (styles, error) {
+	s := defaultStyles()
+
+	// Most colors are the foreground of a style but some styles have more
+	// than one color to set
+	setters := map[string]func(c lipgloss.Color){
+		"title":          func(c lipgloss.Color) { s.Title = s.Title.Copy().Background(c) },
+		"title_text":     func(c lipgloss.Color) { s.Title = s.Title.Copy().Foreground(c) },
+		"normal_title":   func(c lipgloss.Color) { s.NormalTitle = s.NormalTitle.Copy().Foreground(c) },
+		"normal_desc":    func(c lipgloss.Color) { s.NormalDesc = s.NormalDesc.Copy().Foreground(c) },
+		"selected_title": func(c lipgloss.Color) { s.SelectedTitle = s.SelectedTitle.Copy().Foreground(c) },
+		"selected_desc":  func(c lipgloss.Color) { s.SelectedDesc = s.SelectedDesc.Copy().Foreground(c) },
+		"status_passed":  func(c lipgloss.Color) { s.StatusPassed = s.StatusPassed.Copy().Foreground(c) },
+		"status_failed":  func(c lipgloss.Color) { s.StatusFailed = s.StatusFailed.Copy().Foreground(c) },
+		"status_pending": func(c lipgloss.Color) { s.StatusPending = s.StatusPending.Copy().Foreground(c) },
+		"log":            func(c lipgloss.Color) { s.Log = s.Log.Copy().Foreground(c) },
+		"log_border":     func(c lipgloss.Color) { s.Log = s.Log.Copy().BorderForeground(c) },
+		"diff_add":       func(c lipgloss.Color) { s.DiffAdd = s.DiffAdd.Copy().Foreground(c) },
+		"diff_remove":    func(c lipgloss.Color) { s.DiffRemove = s.DiffRemove.Copy().Foreground(c) },
+		"diff_hunk":      func(c lipgloss.Color) { s.DiffHunk = s.DiffHunk.Copy().Foreground(c) },
+	}
+
+	var errs []string
+	for name, color := range config.Colors {
+		set, ok := setters[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown color %q", name))
+			continue
+		}
+		if !validColor(color) {
+			errs = append(errs, fmt.Sprintf("invalid color for %s: %q (expected #rrggbb or 0-255)", name, color))
+			continue
+		}
+		set(lipgloss.Color(color))
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return s, fmt.Errorf("invalid tui colors:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// confirmation is an action waiting to be confirmed
+type confirmation struct {
+	action DashboardAction
+	// items are in the order that the action will be run
+	items []Item
+}
+
+// stackOrder orders items so that the action can be run safely. Syncing and
+// landing has to handle parents before their children. Abandoning runs top
+// down so that children aren't restacked onto a diff that is about to be
+// abandoned.
+func stackOrder(action DashboardAction, items []Item) []Item {
+	ordered := make([]Item, 0, len(items))
+	ordered = append(ordered, items...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if action == Abandon {
+			return ordered[i].Depth > ordered[j].Depth
+		}
+		return ordered[i].Depth < ordered[j].Depth
+	})
+	return ordered
+}
+
+// selectedItems returns the selected items in list order
+func selectedItems(items []Item) []Item {
+	selected := []Item{}
+	for _, i := range items {
+		if i.Selected {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
+
+// stackIDs returns the Diff-Ids of every item in the same stack as the item
+func stackIDs(items []Item, item Item) map[string]bool {
+	parents := map[string]string{}
+	for _, i := range items {
+		if i.ID != "" {
+			parents[i.ID] = i.StackedOn
+		}
+	}
+
+	// walk down to the bottom of the stack
+	root := item.ID
+	for parents[root] != "" {
+		if _, ok := parents[parents[root]]; !ok {
+			break
+		}
+		root = parents[root]
+	}
+
+	// then collect everything stacked on top of it
+	ids := map[string]bool{root: true}
+	for changed := true; changed; {
+		changed = false
+		for id, parent := range parents {
+			if ids[parent] && !ids[id] {
+				ids[id] = true
+				changed = true
+			}
+		}
+	}
+	return ids
+}
+
+// skipReason explains why the action can't be run on an item, or is empty if
+// it can. Items with a reason are skipped when the action is confirmed.
+func (c confirmation) skipReason(item Item) string {
+	switch c.action {
+	case Land:
+		if item.PrNumber == "" {
+			return "can't land: diff doesn't have a PR"
+		}
+		if item.IsStacked && !c.includes(item.StackedOn) {
+			return fmt.Sprintf("can't land: stacked on %s which isn't being landed", item.StackedOn)
+		}
+	case Abandon:
+		if item.IsSaved == false {
+			return "not synced, nothing to abandon"
+		}
+	}
+	return ""
+}
+
+// describe explains what the action will do to an item
+func (c confirmation) describe(item Item) string {
+	if reason := c.skipReason(item); reason != "" {
+		return reason
+	}
+
+	switch c.action {
+	case Land:
+		return fmt.Sprintf("squash merge #%s and sync dependant diffs", item.PrNumber)
+	case Abandon:
+		if item.PrNumber == "" {
+			return "delete branch and restack dependant diffs"
+		}
+		return fmt.Sprintf("close #%s, delete branch and restack dependant diffs", item.PrNumber)
+	default:
+		if item.IsSaved == false {
+			return "create branch and PR"
+		}
+		if item.NeedsSyncing {
+			return "push local changes and sync dependant diffs"
+		}
+		return "up to date, re-push branch"
+	}
+}
+
+// includes returns true if the action will be run on the diff, i.e. it's in
+// the confirmation and isn't skipped
+func (c confirmation) includes(id string) bool {
+	for _, item := range c.items {
+		if item.ID == id {
+			return c.skipReason(item) == ""
+		}
+	}
+	return false
+}
+
+func (c confirmation) view(s styles, keys *KeyMap) string {
+	var b strings.Builder
+
+	noun := "diff"
+	if len(c.items) != 1 {
+		noun = "diffs"
+	}
+	action := c.action.String()
+	action = strings.ToUpper(action[:1]) + action[1:]
+	b.WriteString(s.Title.Render(fmt.Sprintf("%s %d %s?", action, len(c.items), noun)))
+	b.WriteString("\n\n")
+
+	for idx, item := range c.items {
+		b.WriteString(s.NormalTitle.Render(fmt.Sprintf("%d. [%s] %s", idx+1, item.ID, item.Title)))
+		b.WriteString("\n")
+		b.WriteString(s.NormalDesc.Copy().PaddingLeft(3).Render(c.describe(item)))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(s.NormalDesc.Render(fmt.Sprintf(
+		"%s %s • %s %s",
+		keys.Confirm.Help().Key, keys.Confirm.Help().Desc,
+		keys.Cancel.Help().Key, keys.Cancel.Help().Desc,
+	)))
+
+	return s.QuitText.Render(b.String())
+}
@@ -0,0 +1,248 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// detailHeaderHeight is the number of lines above the detail viewport
+const detailHeaderHeight = 4
+
+// Comment is a PR review or comment
+type Comment struct {
+	Author    string
+	State     string
+	Body      string
+	CreatedAt time.Time
+}
+
+// Detail is everything shown in the detail view of a diff
+type Detail struct {
+	Body  string
+	Stat  string
+	Patch string
+	// Interdiff describes how the local commit differs from the pushed
+	// branch. It's only set if the diff needs syncing.
+	Interdiff *Interdiff
+	Reviews   []Comment
+	Comments  []Comment
+}
+
+// Interdiff describes how a local commit differs from the version of the diff
+// that was last pushed
+type Interdiff struct {
+	Summary []string
+	// NeedsReview is set if pushing will change what reviewers have seen
+	NeedsReview bool
+	Diff        string
+}
+
+// DetailLoader loads the detail and interdiff views of a diff
+type DetailLoader interface {
+	LoadDetail(item Item) (Detail, error)
+	LoadInterdiff(item Item) (Interdiff, error)
+}
+
+type detailLoadedMsg struct {
+	commit string
+	render func(s styles) string
+	err    error
+}
+
+func loadDetail(loader DetailLoader, item Item) tea.Cmd {
+	return func() tea.Msg {
+		detail, err := loader.LoadDetail(item)
+		return detailLoadedMsg{
+			commit: item.Commit,
+			render: func(s styles) string { return renderDetail(s, detail) },
+			err:    err,
+		}
+	}
+}
+
+func loadInterdiff(loader DetailLoader, item Item) tea.Cmd {
+	return func() tea.Msg {
+		i, err := loader.LoadInterdiff(item)
+		return detailLoadedMsg{
+			commit: item.Commit,
+			render: func(s styles) string { return renderInterdiff(s, i) },
+			err:    err,
+		}
+	}
+}
+
+// detailView shows the details of a single diff
+type detailView struct {
+	item     Item
+	viewport viewport.Model
+}
+
+func newDetailView(item Item, width, height int) *detailView {
+	vp := viewport.New(width, height-detailHeaderHeight)
+	vp.SetContent("loading…")
+	return &detailView{
+		item:     item,
+		viewport: vp,
+	}
+}
+
+func (d *detailView) setSize(width, height int) {
+	d.viewport.Width = width
+	d.viewport.Height = height - detailHeaderHeight
+}
+
+func (d *detailView) setContent(s styles, render func(s styles) string, err error) {
+	content := render(s)
+	if err != nil {
+		// the detail can be partially loaded so show whatever is there
+		content = s.StatusFailed.Render(fmt.Sprintf("error: %s", err)) + "\n\n" + content
+	}
+	d.viewport.SetContent(content)
+}
+
+func (d *detailView) view(s styles, keys *KeyMap) string {
+	var b strings.Builder
+
+	title := d.item.Title
+	if d.item.ID != "" {
+		title = fmt.Sprintf("[%s] %s", d.item.ID, title)
+	}
+	b.WriteString(s.Title.Render(title))
+	b.WriteString("\n")
+	if d.item.PrLink != "" {
+		b.WriteString(s.NormalDesc.Render(d.item.PrLink))
+	} else {
+		b.WriteString(s.NormalDesc.Render(d.item.Commit))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(d.viewport.View())
+	b.WriteString("\n")
+	b.WriteString(s.NormalDesc.Render(fmt.Sprintf(
+		"%3.f%% • %s %s",
+		d.viewport.ScrollPercent()*100,
+		keys.Cancel.Help().Key, "back",
+	)))
+
+	return s.Detail.Render(b.String())
+}
+
+func renderDetail(s styles, detail Detail) string {
+	var b strings.Builder
+
+	section := func(title string) {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(s.SelectedTitle.Render(title))
+		b.WriteString("\n\n")
+	}
+
+	if strings.TrimSpace(detail.Body) != "" {
+		section("Message")
+		b.WriteString(detail.Body)
+		b.WriteString("\n")
+	}
+
+	if detail.Interdiff != nil {
+		section("Changes since last sync")
+		b.WriteString(renderInterdiff(s, *detail.Interdiff))
+	}
+
+	section("Files")
+	b.WriteString(detail.Stat)
+	b.WriteString("\n")
+
+	section("Patch")
+	b.WriteString(colorPatch(s, detail.Patch))
+	b.WriteString("\n")
+
+	if len(detail.Reviews) > 0 {
+		section("Reviews")
+		for _, review := range detail.Reviews {
+			b.WriteString(renderComment(s, review))
+		}
+	}
+
+	if len(detail.Comments) > 0 {
+		section("Comments")
+		for _, comment := range detail.Comments {
+			b.WriteString(renderComment(s, comment))
+		}
+	}
+
+	return b.String()
+}
+
+func renderInterdiff(s styles, i Interdiff) string {
+	var b strings.Builder
+
+	for idx, line := range i.Summary {
+		// the last line of the summary says whether a re-review is needed
+		if idx == len(i.Summary)-1 && len(i.Summary) > 1 {
+			if i.NeedsReview {
+				line = s.StatusFailed.Render(line)
+			} else {
+				line = s.StatusPassed.Render(line)
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	if i.Diff != "" {
+		b.WriteString("\n")
+		b.WriteString(colorPatch(s, i.Diff))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func renderComment(s styles, c Comment) string {
+	var b strings.Builder
+
+	header := fmt.Sprintf("%s • %s", c.Author, c.CreatedAt.Local().Format("2 Jan 2006 15:04"))
+	b.WriteString(s.NormalTitle.Render(header))
+	switch c.State {
+	case "APPROVED":
+		b.WriteString(" " + s.StatusPassed.Render("approved"))
+	case "CHANGES_REQUESTED":
+		b.WriteString(" " + s.StatusFailed.Render("changes requested"))
+	case "COMMENTED":
+		b.WriteString(" " + s.NormalDesc.Render("commented"))
+	}
+	b.WriteString("\n")
+	if body := strings.TrimSpace(c.Body); body != "" {
+		b.WriteString(s.NormalDesc.Copy().PaddingLeft(2).Render(body))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// colorPatch colors the added and removed lines of a patch
+func colorPatch(s styles, patch string) string {
+	lines := strings.Split(strings.TrimRight(patch, "\n"), "\n")
+	for idx, rawLine := range lines {
+		// range-diff output is indented
+		line := strings.TrimLeft(rawLine, " ")
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[idx] = s.NormalTitle.Render(rawLine)
+		case strings.HasPrefix(line, "diff "):
+			lines[idx] = s.NormalTitle.Render(rawLine)
+		case strings.HasPrefix(line, "@@"):
+			lines[idx] = s.DiffHunk.Render(rawLine)
+		case strings.HasPrefix(line, "+"):
+			lines[idx] = s.DiffAdd.Render(rawLine)
+		case strings.HasPrefix(line, "-"):
+			lines[idx] = s.DiffRemove.Render(rawLine)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,58 @@
+package tui
+
+import "strings"
+
+// only limits the dashboard to the items in a particular state
+type only int
+
+const (
+	showAll only = iota
+	onlyNeedsSync
+	onlyUnsynced
+	onlyFailing
+	onlyAwaitingReview
+)
+
+func (o only) String() string {
+	switch o {
+	case onlyNeedsSync:
+		return "needs sync"
+	case onlyUnsynced:
+		return "unsynced"
+	case onlyFailing:
+		return "failing CI"
+	case onlyAwaitingReview:
+		return "awaiting review"
+	}
+	return "all"
+}
+
+// matches returns true if the item should be shown
+func (o only) matches(i Item) bool {
+	switch o {
+	case onlyNeedsSync:
+		return i.NeedsSyncing
+	case onlyUnsynced:
+		return i.Commit != "" && i.IsSaved == false
+	case onlyFailing:
+		return i.HasPrStatus && i.PrChecksStatus == Failed
+	case onlyAwaitingReview:
+		return i.HasPrStatus && !i.PrIsDraft && i.PrReviewStatus == Pending
+	}
+	return true
+}
+
+// FilterValue is what the fuzzy filter matches against: the title, Diff-Id,
+// branch, PR number and author
+func (i Item) FilterValue() string {
+	fields := []string{i.Title}
+	for _, field := range []string{i.ID, i.Branch, i.Author} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if i.PrNumber != "" {
+		fields = append(fields, "#"+i.PrNumber)
+	}
+	return strings.Join(fields, " ")
+}
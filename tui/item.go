@@ -16,20 +16,64 @@ const (
 	Pending PrStatus = iota
 	Passed
 	Failed
+	// NoStatus is used when GitHub doesn't report a status e.g. when a PR has
+	// no checks configured
+	NoStatus
 )
 
+func (s PrStatus) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Passed:
+		return "passed"
+	case Failed:
+		return "failed"
+	}
+	return "none"
+}
+
 type Item struct {
-	ID             string
-	Commit         string
-	Title          string
-	PrLink         string
-	PrReviewStatus PrStatus
-	IsSaved        bool
-	IsStacked      bool
-	NeedsSyncing   bool
+	ID                  string
+	Commit              string
+	Title               string
+	Author              string
+	PrNumber            string
+	PrLink              string
+	StackedOn           string
+	Branch              string
+	PrReviewStatus      PrStatus
+	PrChecksStatus      PrStatus
+	PrMergeStatus       PrStatus
+	PrIsDraft           bool
+	PrUnresolvedThreads int
+	HasPrStatus         bool
+	IsSaved             bool
+	IsStacked           bool
+	// StackedOnExternal is the branch or PR that the diff is stacked on when
+	// it isn't a local diff
+	StackedOnExternal string
+	// IsLanded is set for diffs that local diffs are stacked on but that are
+	// no longer in the local branch
+	IsLanded     bool
+	NeedsSyncing bool
+	// SyncReason is a short description of what changed since the last sync
+	SyncReason  string
+	IsLoading   bool
+	Selected    bool
+	Action      DashboardAction
+	ActionState ActionState
+	ActionError string
+	// Depth, Graph and DescGraph are set by layoutStacks
+	Depth     int
+	Graph     string
+	DescGraph string
 }
 
-func (i Item) FilterValue() string { return i.Title }
+// isActionable returns true if the item can be synced, landed or abandoned
+func (i Item) isActionable() bool {
+	return i.ID != "" && i.Commit != "" && i.IsLanded == false
+}
 
 type itemDelegate struct {
 	keys   *KeyMap
@@ -43,7 +87,7 @@ func newItemDelegate(keys *KeyMap, styles *styles) *itemDelegate {
 	}
 }
 
-func (d itemDelegate) Height() int                               { return 1 }
+func (d itemDelegate) Height() int                               { return 2 }
 func (d itemDelegate) Spacing() int                              { return 0 }
 func (d itemDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
 
@@ -54,46 +98,139 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 	}
 
 	diffTitle := i.Title
+	if i.IsLanded {
+		diffTitle = fmt.Sprintf("[%s] %s", i.ID, i.Branch)
+	}
 	if i.NeedsSyncing {
 		diffTitle = "* " + diffTitle
 	}
-	subject := d.styles.NormalTitle.Copy().PaddingLeft(2).Render("◯ " + diffTitle)
+	if i.Selected {
+		diffTitle = "✔ " + diffTitle
+	}
 
-	if index == m.Index() {
-		subject = d.styles.SelectedTitle.Copy().PaddingLeft(2).Render("◉ " + diffTitle)
+	graph := d.styles.NormalDesc.Copy().PaddingLeft(2).Render(i.Graph)
+
+	var subject string
+	switch {
+	case index == m.Index():
+		subject = d.styles.SelectedTitle.Render("◉ " + diffTitle)
+	case i.IsLanded:
+		subject = d.styles.NormalDesc.Render("◌ " + diffTitle)
+	default:
+		subject = d.styles.NormalTitle.Render("◯ " + diffTitle)
 	}
 
 	var itemListStyle strings.Builder
+	itemListStyle.WriteString(graph)
 	itemListStyle.WriteString(subject)
 	itemListStyle.WriteString("\n")
 
 	// Render description
 	var desc strings.Builder
 
-	if i.IsStacked == true {
-		desc.WriteString(d.styles.NormalDesc.Copy().PaddingLeft(2).Render("│ "))
-	} else {
-		desc.WriteString(d.styles.NormalDesc.Copy().PaddingLeft(4).Render(""))
-	}
+	desc.WriteString(d.styles.NormalDesc.Copy().PaddingLeft(2).Render(i.DescGraph))
 
 	pr := d.styles.NormalDesc.Render
-	if i.PrLink != "" {
+	if i.IsLoading {
+		desc.WriteString(pr("loading…"))
+	} else if i.IsLanded {
+		desc.WriteString(pr("landed"))
+	} else if i.ID == "" {
+		desc.WriteString(pr(fmt.Sprintf("no Diff-Id (%s to add one)", d.keys.Adopt.Help().Key)))
+	} else if i.PrLink != "" {
 		desc.WriteString(pr(fmt.Sprintf(i.PrLink)))
 	} else {
 		desc.WriteString(pr("-"))
 	}
 
+	if i.StackedOnExternal != "" {
+		desc.WriteString(pr(fmt.Sprintf("  on %s", i.StackedOnExternal)))
+	}
+
+	if i.HasPrStatus {
+		desc.WriteString(d.renderPrStatus(i))
+	}
+
+	if i.NeedsSyncing && i.SyncReason != "" {
+		desc.WriteString("  ")
+		desc.WriteString(d.styles.StatusPending.Render(fmt.Sprintf("needs sync (%s)", i.SyncReason)))
+	}
+
+	if i.ActionState != ActionNone {
+		desc.WriteString("  ")
+		desc.WriteString(d.renderActionState(i))
+	}
+
 	itemListStyle.WriteString(desc.String())
 
 	fmt.Fprint(w, itemListStyle.String())
 }
 
+func (d itemDelegate) renderPrStatus(i Item) string {
+	var status strings.Builder
+
+	icon := func(label string, s PrStatus) string {
+		switch s {
+		case Passed:
+			return d.styles.StatusPassed.Render(label + " ✓")
+		case Failed:
+			return d.styles.StatusFailed.Render(label + " ✗")
+		case Pending:
+			return d.styles.StatusPending.Render(label + " ●")
+		}
+		return ""
+	}
+
+	for _, s := range []string{
+		icon("review", i.PrReviewStatus),
+		icon("ci", i.PrChecksStatus),
+	} {
+		if s != "" {
+			status.WriteString("  ")
+			status.WriteString(s)
+		}
+	}
+
+	if i.PrMergeStatus == Failed {
+		status.WriteString("  ")
+		status.WriteString(d.styles.StatusFailed.Render("⚠ conflicts"))
+	}
+
+	if i.PrUnresolvedThreads > 0 {
+		status.WriteString("  ")
+		status.WriteString(d.styles.StatusPending.Render(fmt.Sprintf("💬 %d", i.PrUnresolvedThreads)))
+	}
+
+	if i.PrIsDraft {
+		status.WriteString("  ")
+		status.WriteString(d.styles.NormalDesc.Render("draft"))
+	}
+
+	return status.String()
+}
+
+func (d itemDelegate) renderActionState(i Item) string {
+	switch i.ActionState {
+	case ActionQueued:
+		return d.styles.NormalDesc.Render(fmt.Sprintf("… %s queued", i.Action))
+	case ActionRunning:
+		return d.styles.StatusPending.Render(fmt.Sprintf("⟳ %s", i.Action.progressive()))
+	case ActionSucceeded:
+		return d.styles.StatusPassed.Render(fmt.Sprintf("✓ %s", i.Action.pastTense()))
+	case ActionFailed:
+		return d.styles.StatusFailed.Render(fmt.Sprintf("✗ %s failed: %s", i.Action, i.ActionError))
+	}
+	return ""
+}
+
 func (d itemDelegate) ShortHelp() []key.Binding {
-	return []key.Binding{d.keys.Sync, d.keys.Land}
+	return []key.Binding{d.keys.Select, d.keys.Sync, d.keys.Land, d.keys.Abandon, d.keys.Refresh}
 }
 
 func (d itemDelegate) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{d.keys.Sync, d.keys.Land},
+		{d.keys.Enter, d.keys.Interdiff, d.keys.Select, d.keys.SelectStack},
+		{d.keys.Sync, d.keys.Land, d.keys.Abandon, d.keys.Adopt, d.keys.Reorder, d.keys.Refresh},
+		{d.keys.OnlyNeedsSync, d.keys.OnlyUnsynced, d.keys.OnlyFailing, d.keys.OnlyAwaitingReview},
 	}
 }
@@ -5,20 +5,37 @@ import (
 )
 
 type KeyMap struct {
-	CursorUp   key.Binding
-	CursorDown key.Binding
-	Enter      key.Binding
-	Sync       key.Binding
-	Land       key.Binding
-	Cancel     key.Binding
-	Quit       key.Binding
-	ForceQuit  key.Binding
+	CursorUp    key.Binding
+	CursorDown  key.Binding
+	Enter       key.Binding
+	Interdiff   key.Binding
+	Select      key.Binding
+	SelectStack key.Binding
+	Sync        key.Binding
+	Land        key.Binding
+	Abandon     key.Binding
+	Adopt       key.Binding
+	Reorder     key.Binding
+	Refresh     key.Binding
+	Filter      key.Binding
+	// The Only bindings toggle showing only the items in a state
+	OnlyNeedsSync      key.Binding
+	OnlyUnsynced       key.Binding
+	OnlyFailing        key.Binding
+	OnlyAwaitingReview key.Binding
+	// MoveUp and MoveDown move the item under the cursor while reordering
+	MoveUp    key.Binding
+	MoveDown  key.Binding
+	Confirm   key.Binding
+	Cancel    key.Binding
+	Quit      key.Binding
+	ForceQuit key.Binding
 }
 
 func (k KeyMap) ShortHelp() []key.Binding {
 	var kb []key.Binding
 
-	kb = append(kb, k.Sync, k.Land, k.Cancel, k.ForceQuit)
+	kb = append(kb, k.Sync, k.Land, k.Refresh, k.Cancel, k.ForceQuit)
 
 	return kb
 }
@@ -27,6 +44,35 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{}
 }
 
+// bindings returns the bindings by the name used in the config
+func (k *KeyMap) bindings() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"cursor_up":            &k.CursorUp,
+		"cursor_down":          &k.CursorDown,
+		"enter":                &k.Enter,
+		"interdiff":            &k.Interdiff,
+		"select":               &k.Select,
+		"select_stack":         &k.SelectStack,
+		"sync":                 &k.Sync,
+		"land":                 &k.Land,
+		"abandon":              &k.Abandon,
+		"adopt":                &k.Adopt,
+		"reorder":              &k.Reorder,
+		"move_up":              &k.MoveUp,
+		"move_down":            &k.MoveDown,
+		"refresh":              &k.Refresh,
+		"filter":               &k.Filter,
+		"only_needs_sync":      &k.OnlyNeedsSync,
+		"only_unsynced":        &k.OnlyUnsynced,
+		"only_failing":         &k.OnlyFailing,
+		"only_awaiting_review": &k.OnlyAwaitingReview,
+		"confirm":              &k.Confirm,
+		"cancel":               &k.Cancel,
+		"quit":                 &k.Quit,
+		"force_quit":           &k.ForceQuit,
+	}
+}
+
 func NewKeyMap() *KeyMap {
 	return &KeyMap{
 		CursorUp: key.NewBinding(
@@ -39,7 +85,19 @@ func NewKeyMap() *KeyMap {
 		),
 		Enter: key.NewBinding(
 			key.WithKeys("enter"),
-			key.WithHelp("enter", "sync diff"),
+			key.WithHelp("enter", "view diff"),
+		),
+		Interdiff: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "changes since sync"),
+		),
+		Select: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "select"),
+		),
+		SelectStack: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "select stack"),
 		),
 		Sync: key.NewBinding(
 			key.WithKeys("s"),
@@ -49,6 +107,54 @@ func NewKeyMap() *KeyMap {
 			key.WithKeys("l"),
 			key.WithHelp("l", "land diff"),
 		),
+		Abandon: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "abandon diff"),
+		),
+		Adopt: key.NewBinding(
+			key.WithKeys("A"),
+			key.WithHelp("A", "add Diff-Id"),
+		),
+		Reorder: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", "reorder"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("K", "shift+up"),
+			key.WithHelp("K", "move up"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("J", "shift+down"),
+			key.WithHelp("J", "move down"),
+		),
+		Refresh: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "refresh"),
+		),
+		Filter: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "filter"),
+		),
+		OnlyNeedsSync: key.NewBinding(
+			key.WithKeys("1"),
+			key.WithHelp("1", "only needs sync"),
+		),
+		OnlyUnsynced: key.NewBinding(
+			key.WithKeys("2"),
+			key.WithHelp("2", "only unsynced"),
+		),
+		OnlyFailing: key.NewBinding(
+			key.WithKeys("3"),
+			key.WithHelp("3", "only failing CI"),
+		),
+		OnlyAwaitingReview: key.NewBinding(
+			key.WithKeys("4"),
+			key.WithHelp("4", "only awaiting review"),
+		),
+		Confirm: key.NewBinding(
+			key.WithKeys("y", "enter"),
+			key.WithHelp("y", "confirm"),
+		),
 		Cancel: key.NewBinding(
 			key.WithKeys("esc"),
 			key.WithHelp("esc", "cancel"),
@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Loader loads the data shown in the dashboard. All the methods are called
+// from tea.Cmds so they can take as long as they need without blocking the UI.
+type Loader interface {
+	// LoadItems returns an item for every commit. Only the fields that are
+	// quick to compute need to be set, the rest are filled in by LoadItem.
+	LoadItems() ([]Item, error)
+	// LoadItem fills in the remaining fields of an item
+	LoadItem(item Item) (Item, error)
+	// LoadPrStatuses fetches the PR status of the items, keyed by commit
+	LoadPrStatuses(items []Item) (map[string]Item, error)
+}
+
+type itemsLoadedMsg struct {
+	generation int
+	items      []Item
+	err        error
+}
+
+type itemLoadedMsg struct {
+	generation int
+	item       Item
+	err        error
+}
+
+type prStatusesLoadedMsg struct {
+	generation int
+	statuses   map[string]Item
+	err        error
+}
+
+type autoRefreshMsg struct{}
+
+func loadItems(loader Loader, generation int) tea.Cmd {
+	return func() tea.Msg {
+		items, err := loader.LoadItems()
+		return itemsLoadedMsg{generation: generation, items: items, err: err}
+	}
+}
+
+func loadItem(loader Loader, generation int, item Item) tea.Cmd {
+	return func() tea.Msg {
+		loaded, err := loader.LoadItem(item)
+		if err != nil {
+			loaded = item
+		}
+		loaded.IsLoading = false
+		return itemLoadedMsg{generation: generation, item: loaded, err: err}
+	}
+}
+
+func loadPrStatuses(loader Loader, generation int, items []Item) tea.Cmd {
+	return func() tea.Msg {
+		statuses, err := loader.LoadPrStatuses(items)
+		return prStatusesLoadedMsg{generation: generation, statuses: statuses, err: err}
+	}
+}
+
+func scheduleAutoRefresh(interval time.Duration) tea.Cmd {
+	if interval <= 0 {
+		return nil
+	}
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		return autoRefreshMsg{}
+	})
+}
+
+// copyPrStatus copies the PR status fields from one item to another
+func copyPrStatus(dst *Item, src Item) {
+	dst.PrReviewStatus = src.PrReviewStatus
+	dst.PrChecksStatus = src.PrChecksStatus
+	dst.PrMergeStatus = src.PrMergeStatus
+	dst.PrIsDraft = src.PrIsDraft
+	dst.PrUnresolvedThreads = src.PrUnresolvedThreads
+	dst.HasPrStatus = src.HasPrStatus
+}
+
+// copyLayout copies the stack graph fields from one item to another
+func copyLayout(dst *Item, src Item) {
+	dst.Depth = src.Depth
+	dst.Graph = src.Graph
+	dst.DescGraph = src.DescGraph
+}
+
+// copyActionState copies the action fields from one item to another
+func copyActionState(dst *Item, src Item) {
+	dst.Action = src.Action
+	dst.ActionState = src.ActionState
+	dst.ActionError = src.ActionError
+}
+
+// findItem returns the index of the item for a commit or -1 if it can't be
+// found
+func findItem(items []Item, commit string) int {
+	if commit == "" {
+		return -1
+	}
+	for idx, i := range items {
+		if i.Commit == commit {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reorderView moves the local commits around before they are reordered with
+// a rebase. The items are in commit order with the oldest first.
+type reorderView struct {
+	items  []Item
+	cursor int
+	// original is the order of the commits when the view was opened
+	original []string
+	// moved is the last item that was moved. The reorder action is shown on
+	// it in the list.
+	moved Item
+}
+
+func newReorderView(items []Item, cursor int) *reorderView {
+	original := make([]string, 0, len(items))
+	for _, item := range items {
+		original = append(original, item.Commit)
+	}
+	return &reorderView{
+		items:    items,
+		cursor:   cursor,
+		original: original,
+	}
+}
+
+func (r *reorderView) cursorUp() {
+	if r.cursor > 0 {
+		r.cursor--
+	}
+}
+
+func (r *reorderView) cursorDown() {
+	if r.cursor < len(r.items)-1 {
+		r.cursor++
+	}
+}
+
+// move swaps the item under the cursor with the one before (-1) or after (1)
+// it and keeps the cursor on it
+func (r *reorderView) move(by int) {
+	to := r.cursor + by
+	if to < 0 || to >= len(r.items) {
+		return
+	}
+	r.items[r.cursor], r.items[to] = r.items[to], r.items[r.cursor]
+	r.cursor = to
+	r.moved = r.items[to]
+}
+
+// order returns the commits in their new order
+func (r *reorderView) order() []string {
+	order := make([]string, 0, len(r.items))
+	for _, item := range r.items {
+		order = append(order, item.Commit)
+	}
+	return order
+}
+
+func (r *reorderView) changed() bool {
+	for idx, commit := range r.order() {
+		if r.original[idx] != commit {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reorderView) view(s styles, keys *KeyMap) string {
+	var b strings.Builder
+
+	b.WriteString(s.Title.Render("Reorder diffs (oldest first)"))
+	b.WriteString("\n\n")
+
+	for idx, item := range r.items {
+		id := item.ID
+		if id == "" {
+			id = fmt.Sprintf("%.7s", item.Commit)
+		}
+		line := fmt.Sprintf("%d. [%s] %s", idx+1, id, item.Title)
+		if idx == r.cursor {
+			b.WriteString(s.SelectedTitle.Render("◉ " + line))
+		} else {
+			b.WriteString(s.NormalTitle.Render("◯ " + line))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(s.NormalDesc.Render(fmt.Sprintf(
+		"%s %s • %s %s • %s %s • %s %s",
+		keys.MoveUp.Help().Key, keys.MoveUp.Help().Desc,
+		keys.MoveDown.Help().Key, keys.MoveDown.Help().Desc,
+		keys.Confirm.Help().Key, "reorder",
+		keys.Cancel.Help().Key, keys.Cancel.Help().Desc,
+	)))
+
+	return s.QuitText.Render(b.String())
+}
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+)
+
+// layoutStacks orders the items as a forest of stacks, with the bottom of each
+// stack first, and sets the connectors used to draw the stack graph. Items are
+// expected to be in rev-list order (newest commit first).
+func layoutStacks(items []Item) []Item {
+	index := map[string]int{}
+	for idx, item := range items {
+		if item.ID != "" {
+			index[item.ID] = idx
+		}
+	}
+
+	children := map[int][]int{}
+	roots := []int{}
+	for idx, item := range items {
+		parent, ok := index[item.StackedOn]
+		if item.ID == "" || item.StackedOn == "" || !ok || parent == idx {
+			roots = append(roots, idx)
+			continue
+		}
+		children[parent] = append(children[parent], idx)
+	}
+
+	// newest is the position of the newest commit in each subtree. It's used
+	// to keep the stack containing HEAD at the top.
+	newest := map[int]int{}
+	var findNewest func(idx int, seen map[int]bool) int
+	findNewest = func(idx int, seen map[int]bool) int {
+		if seen[idx] {
+			return idx
+		}
+		seen[idx] = true
+		n := idx
+		for _, child := range children[idx] {
+			if c := findNewest(child, seen); c < n {
+				n = c
+			}
+		}
+		newest[idx] = n
+		return n
+	}
+	for _, root := range roots {
+		findNewest(root, map[int]bool{})
+	}
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		return newest[roots[i]] < newest[roots[j]]
+	})
+	for parent := range children {
+		// older commits first so that linear stacks read bottom to top
+		sort.SliceStable(children[parent], func(i, j int) bool {
+			return children[parent][i] > children[parent][j]
+		})
+	}
+
+	laidOut := make([]Item, 0, len(items))
+	visited := map[int]bool{}
+
+	var walk func(idx int, lead string, depth int, last bool)
+	walk = func(idx int, lead string, depth int, last bool) {
+		if visited[idx] {
+			return
+		}
+		visited[idx] = true
+
+		item := items[idx]
+		item.Depth = depth
+		hasChildren := len(children[idx]) > 0
+
+		var graph, descGraph strings.Builder
+		graph.WriteString(lead)
+		descGraph.WriteString(lead)
+		childLead := lead
+		if depth > 0 {
+			if last {
+				graph.WriteString("└─")
+				descGraph.WriteString("  ")
+				childLead += "  "
+			} else {
+				graph.WriteString("├─")
+				descGraph.WriteString("│ ")
+				childLead += "│ "
+			}
+		}
+		if hasChildren {
+			descGraph.WriteString("│ ")
+		} else {
+			descGraph.WriteString("  ")
+		}
+		item.Graph = graph.String()
+		item.DescGraph = descGraph.String()
+
+		laidOut = append(laidOut, item)
+
+		for i, child := range children[idx] {
+			walk(child, childLead, depth+1, i == len(children[idx])-1)
+		}
+	}
+
+	for _, root := range roots {
+		walk(root, "", 0, true)
+	}
+
+	// Anything that hasn't been visited is part of a cycle in stacked_on so
+	// just show it on its own
+	for idx := range items {
+		if !visited[idx] {
+			walk(idx, "", 0, true)
+		}
+	}
+
+	return laidOut
+}
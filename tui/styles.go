@@ -14,6 +14,17 @@ type styles struct {
 	SelectedTitle lipgloss.Style
 	SelectedDesc  lipgloss.Style
 
+	StatusPassed  lipgloss.Style
+	StatusFailed  lipgloss.Style
+	StatusPending lipgloss.Style
+
+	Log    lipgloss.Style
+	Detail lipgloss.Style
+
+	DiffAdd    lipgloss.Style
+	DiffRemove lipgloss.Style
+	DiffHunk   lipgloss.Style
+
 	Pagination lipgloss.Style
 	Help       lipgloss.Style
 	QuitText   lipgloss.Style
@@ -37,6 +48,34 @@ func defaultStyles() (s styles) {
 	s.SelectedDesc = lipgloss.NewStyle().
 		Foreground(lipgloss.AdaptiveColor{Light: "#F793FF", Dark: "#AD58B4"})
 
+	s.StatusPassed = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#16a34a", Dark: "#4ade80"})
+
+	s.StatusFailed = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#dc2626", Dark: "#f87171"})
+
+	s.StatusPending = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#ca8a04", Dark: "#facc15"})
+
+	s.Log = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#64748b", Dark: "#777777"}).
+		Border(lipgloss.NormalBorder(), false, false, false, true).
+		BorderForeground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#555555"}).
+		MarginLeft(4).
+		PaddingLeft(1)
+
+	s.Detail = lipgloss.NewStyle().
+		PaddingLeft(2)
+
+	s.DiffAdd = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#16a34a", Dark: "#4ade80"})
+
+	s.DiffRemove = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#dc2626", Dark: "#f87171"})
+
+	s.DiffHunk = lipgloss.NewStyle().
+		Foreground(lipgloss.AdaptiveColor{Light: "#0891b2", Dark: "#22d3ee"})
+
 	s.Pagination = list.DefaultStyles().
 		PaginationStyle.
 		PaddingLeft(4)
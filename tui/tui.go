@@ -1,6 +1,10 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/paginator"
@@ -8,8 +12,13 @@ import (
 )
 
 const (
+	listTitle    = "Your queue"
 	defaultWidth = 20
 	listHeight   = 15
+	// logHeight is the number of lines of action output shown in the log pane
+	logHeight = 8
+	// maxLogLines is the number of lines of action output that are kept
+	maxLogLines = 500
 )
 
 type DashboardAction int
@@ -17,68 +26,688 @@ type DashboardAction int
 const (
 	Sync DashboardAction = iota
 	Land
+	Abandon
+	// Adopt adds a Diff-Id to a commit that doesn't have one
+	Adopt
+	// Reorder rebases the local commits into a new order
+	Reorder
+)
+
+type state int
+
+const (
+	listState state = iota
+	confirmState
+	detailState
+	reorderState
 )
 
 type Model struct {
 	list   list.Model
 	keyMap *KeyMap
-	choice list.Item
-	action DashboardAction
-	// styles styles.Styles
-	// state  state
+	styles styles
+	state  state
+	// items are all of the items. Only the ones that match the only toggle
+	// are passed to the list.
+	items []Item
+	// commits are the local commits in commit order, oldest first
+	commits         []string
+	only            only
+	confirm         *confirmation
+	detail          *detailView
+	reorder         *reorderView
+	width           int
+	height          int
+	backend         Backend
+	refreshInterval time.Duration
+	// generation is incremented on every refresh so that results from
+	// previous loads can be ignored
+	generation int
+	// loading is the number of load commands that haven't returned yet
+	loading int
+	err     error
+	// queue is the actions waiting to run. Actions are run one at a time
+	// because they all change the state of the git repo.
+	queue   []queuedAction
+	running *actionRun
+	log     []string
 }
 
-func NewModel(items []list.Item) Model {
-	styles := defaultStyles()
-	keys := NewKeyMap()
+// NewModel creates the dashboard model. Items are loaded in the background
+// using the backend and reloaded every refreshInterval (if it's greater than
+// 0). The keys and colors are customised by the config.
+func NewModel(backend Backend, refreshInterval time.Duration, config Config) (Model, error) {
+	styles, err := newStyles(config)
+	if err != nil {
+		return Model{}, err
+	}
+	keys, err := NewKeyMapFromConfig(config)
+	if err != nil {
+		return Model{}, err
+	}
 
-	l := list.New(items, newItemDelegate(keys, &styles), defaultWidth, listHeight)
-	l.Title = "Your queue"
+	l := list.New([]list.Item{}, newItemDelegate(keys, &styles), defaultWidth, listHeight)
+	l.Title = listTitle
 	l.SetShowStatusBar(false)
 	l.Paginator.Type = paginator.Arabic
 	l.Styles.PaginationStyle = styles.Pagination
 	l.Styles.HelpStyle = styles.Help
-	l.SetFilteringEnabled(false)
+	l.KeyMap.Filter = keys.Filter
+	unbindListKeys(&l.KeyMap, keys)
+	// quitting is handled by the dashboard so that the keys can be remapped
+	l.KeyMap.Quit.SetEnabled(false)
+	l.KeyMap.ForceQuit.SetEnabled(false)
 
 	return Model{
-		keyMap: keys,
-		list:   l,
-	}
+		keyMap:          keys,
+		styles:          styles,
+		list:            l,
+		backend:         backend,
+		refreshInterval: refreshInterval,
+		loading:         1,
+	}, nil
 }
 
 func (m Model) Init() tea.Cmd {
+	return tea.Batch(
+		m.list.StartSpinner(),
+		loadItems(m.backend, m.generation),
+		scheduleAutoRefresh(m.refreshInterval),
+	)
+}
+
+// refresh reloads all the items. Any load that is already in progress is
+// discarded.
+func (m *Model) refresh() tea.Cmd {
+	m.generation++
+	m.loading = 1
+	m.err = nil
+	return tea.Batch(
+		m.list.StartSpinner(),
+		loadItems(m.backend, m.generation),
+	)
+}
+
+// loadDone records that a load command has returned. Once everything has
+// loaded the next queued action is started.
+func (m *Model) loadDone() tea.Cmd {
+	m.loading--
+	if m.loading <= 0 {
+		m.loading = 0
+		m.list.StopSpinner()
+		return m.startNextAction()
+	}
+	return nil
+}
+
+func (m *Model) handleItemsLoaded(msg itemsLoadedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.err = msg.err
+		return m.loadDone()
+	}
+
+	// Keep the details of items that have already been loaded so that the list
+	// doesn't flicker on refresh
+	previous := m.items
+	items := make([]Item, 0, len(msg.items))
+	cmds := []tea.Cmd{}
+	for _, item := range layoutStacks(msg.items) {
+		if idx := findItem(previous, item.Commit); idx != -1 {
+			laidOut := item
+			item = previous[idx]
+			copyLayout(&item, laidOut)
+		} else if item.Commit != "" && item.ID != "" {
+			item.IsLoading = true
+			if idx := findItemByID(previous, item.ID); idx != -1 {
+				copyActionState(&item, previous[idx])
+			}
+		}
+		items = append(items, item)
+
+		// Only diffs in the local branch have details to load
+		if item.Commit != "" && item.ID != "" {
+			m.loading++
+			cmds = append(cmds, loadItem(m.backend, msg.generation, item))
+		}
+	}
+	m.loading++
+	cmds = append(cmds, loadPrStatuses(m.backend, msg.generation, msg.items))
+	cmds = append(cmds, m.setItems(items))
+
+	// The loaded items are newest first
+	m.commits = []string{}
+	for idx := len(msg.items) - 1; idx >= 0; idx-- {
+		if item := msg.items[idx]; item.Commit != "" && !item.IsLanded {
+			m.commits = append(m.commits, item.Commit)
+		}
+	}
+
+	// loadItems itself has returned
+	cmds = append(cmds, m.loadDone())
+
+	return tea.Batch(cmds...)
+}
+
+func (m *Model) handleItemLoaded(msg itemLoadedMsg) tea.Cmd {
+	cmds := []tea.Cmd{m.loadDone()}
+	if msg.err != nil {
+		m.err = msg.err
+	}
+
+	idx := findItem(m.items, msg.item.Commit)
+	if idx == -1 {
+		return tea.Batch(cmds...)
+	}
+	// PR statuses are loaded separately and actions can change while the item
+	// loads so keep whatever is already there
+	item := msg.item
+	current := m.items[idx]
+	copyPrStatus(&item, current)
+	copyActionState(&item, current)
+	copyLayout(&item, current)
+	item.Selected = current.Selected
+	cmds = append(cmds, m.setItem(idx, item))
+	return tea.Batch(cmds...)
+}
+
+func (m *Model) handlePrStatusesLoaded(msg prStatusesLoadedMsg) tea.Cmd {
+	cmds := []tea.Cmd{m.loadDone()}
+	if msg.err != nil {
+		m.err = msg.err
+		return tea.Batch(cmds...)
+	}
+
+	for idx, item := range m.items {
+		status, ok := msg.statuses[item.Commit]
+		if !ok {
+			continue
+		}
+		copyPrStatus(&m.items[idx], status)
+	}
+	cmds = append(cmds, m.updateList())
+	return tea.Batch(cmds...)
+}
+
+// setActionState updates the action state of the item that the action is for
+func (m *Model) setActionState(qa queuedAction, state ActionState, actionErr string) tea.Cmd {
+	idx := qa.find(m.items)
+	if idx == -1 {
+		return nil
+	}
+	item := m.items[idx]
+	item.Action = qa.action
+	item.ActionState = state
+	item.ActionError = actionErr
+	return m.setItem(idx, item)
+}
+
+// setItems replaces all of the items
+func (m *Model) setItems(items []Item) tea.Cmd {
+	m.items = items
+	return m.updateList()
+}
+
+// setItem replaces the item at idx in m.items
+func (m *Model) setItem(idx int, item Item) tea.Cmd {
+	m.items[idx] = item
+	return m.updateList()
+}
+
+// updateList passes the items that match the only toggle to the list
+func (m *Model) updateList() tea.Cmd {
+	visible := make([]list.Item, 0, len(m.items))
+	for _, item := range m.items {
+		if m.only.matches(item) {
+			visible = append(visible, item)
+		}
+	}
+	return m.list.SetItems(visible)
+}
+
+// toggleOnly shows only the items that match o, or all items if o is already
+// being shown
+func (m *Model) toggleOnly(o only) tea.Cmd {
+	if m.only == o {
+		o = showAll
+	}
+	m.only = o
+	m.list.Title = listTitle
+	if o != showAll {
+		m.list.Title = fmt.Sprintf("%s (%s)", listTitle, o)
+	}
+	m.list.ResetSelected()
+	return m.updateList()
+}
+
+// openDetail shows the detail view for the item under the cursor
+func (m *Model) openDetail() tea.Cmd {
+	item, ok := m.list.SelectedItem().(Item)
+	if !ok || item.Commit == "" {
+		return nil
+	}
+
+	m.detail = newDetailView(item, m.width, m.height)
+	m.state = detailState
+	return loadDetail(m.backend, item)
+}
+
+// openInterdiff shows how the item under the cursor has changed since it was
+// last synced
+func (m *Model) openInterdiff() tea.Cmd {
+	item, ok := m.list.SelectedItem().(Item)
+	if !ok || !item.isActionable() || item.IsSaved == false {
+		return nil
+	}
+
+	m.detail = newDetailView(item, m.width, m.height)
+	m.state = detailState
+	return loadInterdiff(m.backend, item)
+}
+
+// toggleSelected selects or deselects the item under the cursor
+func (m *Model) toggleSelected() tea.Cmd {
+	item, ok := m.list.SelectedItem().(Item)
+	if !ok || !item.isActionable() {
+		return nil
+	}
+	// The list index is the position in the filtered items so find the item
+	// by commit instead
+	idx := findItem(m.items, item.Commit)
+	if idx == -1 {
+		return nil
+	}
+	item.Selected = !item.Selected
+	return m.setItem(idx, item)
+}
+
+// selectStack selects every item in the same stack as the item under the
+// cursor
+func (m *Model) selectStack() tea.Cmd {
+	item, ok := m.list.SelectedItem().(Item)
+	if !ok || item.ID == "" {
+		return nil
+	}
+
+	ids := stackIDs(m.items, item)
+	for idx, i := range m.items {
+		if ids[i.ID] && i.isActionable() {
+			m.items[idx].Selected = true
+		}
+	}
+	return m.updateList()
+}
+
+// clearSelection deselects all the items
+func (m *Model) clearSelection() tea.Cmd {
+	for idx := range m.items {
+		m.items[idx].Selected = false
+	}
+	return m.updateList()
+}
+
+// requestAction runs the action on the selected items, or the item under the
+// cursor if nothing is selected. Actions on multiple items and abandoning
+// have to be confirmed first.
+func (m *Model) requestAction(action DashboardAction) tea.Cmd {
+	items := selectedItems(m.items)
+	if len(items) == 0 {
+		item, ok := m.list.SelectedItem().(Item)
+		if !ok || !item.isActionable() {
+			return nil
+		}
+		if action != Abandon {
+			return m.queueAction(action, item)
+		}
+		items = []Item{item}
+	}
+
+	m.confirm = &confirmation{
+		action: action,
+		items:  stackOrder(action, items),
+	}
+	m.state = confirmState
 	return nil
 }
 
+// adopt adds a Diff-Id to the commit under the cursor
+func (m *Model) adopt() tea.Cmd {
+	item, ok := m.list.SelectedItem().(Item)
+	if !ok || item.ID != "" || item.Commit == "" {
+		return nil
+	}
+	return m.queueAction(Adopt, item)
+}
+
+// openReorder shows the local commits so that they can be moved around.
+// Reordering rewrites every commit so it can only start once nothing else is
+// running.
+func (m *Model) openReorder() tea.Cmd {
+	if m.running != nil || len(m.queue) > 0 {
+		m.appendLog("wait for the running actions to finish before reordering")
+		return nil
+	}
+	if len(m.commits) < 2 {
+		return nil
+	}
+
+	items := make([]Item, 0, len(m.commits))
+	cursor := 0
+	selected, _ := m.list.SelectedItem().(Item)
+	for _, commit := range m.commits {
+		idx := findItem(m.items, commit)
+		if idx == -1 {
+			continue
+		}
+		if commit == selected.Commit {
+			cursor = len(items)
+		}
+		items = append(items, m.items[idx])
+	}
+
+	m.reorder = newReorderView(items, cursor)
+	m.state = reorderState
+	return nil
+}
+
+// confirmReorder queues the reorder if the order has changed
+func (m *Model) confirmReorder() tea.Cmd {
+	r := m.reorder
+	m.reorder = nil
+	m.state = listState
+	if !r.changed() {
+		return nil
+	}
+
+	qa := queuedAction{action: Reorder, id: r.moved.ID, commit: r.moved.Commit, order: r.order()}
+	return m.enqueue(qa, r.moved)
+}
+
+// confirmAction queues the action that is waiting to be confirmed
+func (m *Model) confirmAction() tea.Cmd {
+	c := m.confirm
+	m.confirm = nil
+	m.state = listState
+
+	cmds := []tea.Cmd{m.clearSelection()}
+	for _, item := range c.items {
+		if reason := c.skipReason(item); reason != "" {
+			m.appendLog(fmt.Sprintf("skipping [%s]: %s", item.ID, reason))
+			continue
+		}
+		cmds = append(cmds, m.queueAction(c.action, item))
+	}
+	return tea.Batch(cmds...)
+}
+
+// queueAction queues an action for an item
+func (m *Model) queueAction(action DashboardAction, item Item) tea.Cmd {
+	return m.enqueue(queuedAction{action: action, id: item.ID, commit: item.Commit}, item)
+}
+
+// enqueue adds an action to the queue and starts it if nothing else is running
+func (m *Model) enqueue(qa queuedAction, item Item) tea.Cmd {
+	if item.ActionState == ActionQueued || item.ActionState == ActionRunning {
+		return nil
+	}
+
+	m.queue = append(m.queue, qa)
+	return tea.Batch(
+		m.setActionState(qa, ActionQueued, ""),
+		m.startNextAction(),
+	)
+}
+
+// startNextAction starts the next queued action as long as nothing else is
+// running and the items have finished loading
+func (m *Model) startNextAction() tea.Cmd {
+	if m.running != nil || m.loading > 0 || len(m.queue) == 0 {
+		return nil
+	}
+
+	qa := m.queue[0]
+	m.queue = m.queue[1:]
+
+	idx := qa.find(m.items)
+	if idx == -1 {
+		m.appendLog(fmt.Sprintf("can't %s %s: diff no longer exists", qa.action, qa.target()))
+		return m.startNextAction()
+	}
+	item := m.items[idx]
+
+	m.appendLog(fmt.Sprintf("$ %s %s (%s)", qa.action, item.Title, qa.target()))
+
+	run, err := startAction(qa, qa.command(m.backend, item))
+	if err != nil {
+		m.appendLog(err.Error())
+		return tea.Batch(
+			m.setActionState(qa, ActionFailed, err.Error()),
+			m.startNextAction(),
+		)
+	}
+	m.running = run
+
+	return tea.Batch(
+		m.setActionState(qa, ActionRunning, ""),
+		waitForActionOutput(run),
+	)
+}
+
+func (m *Model) handleActionDone(msg actionDoneMsg) tea.Cmd {
+	run := m.running
+	m.running = nil
+
+	var cmd tea.Cmd
+	if msg.err != nil {
+		// the last line of output is usually the most useful
+		actionErr := msg.err.Error()
+		if len(m.log) > 0 {
+			actionErr = m.log[len(m.log)-1]
+		}
+		cmd = m.setActionState(run.queuedAction, ActionFailed, actionErr)
+	} else {
+		cmd = m.setActionState(run.queuedAction, ActionSucceeded, "")
+	}
+
+	// Syncing and landing rewrites commits so reload everything before
+	// starting the next action
+	return tea.Batch(cmd, m.refresh())
+}
+
+func (m *Model) appendLog(line string) {
+	m.log = append(m.log, line)
+	if len(m.log) > maxLogLines {
+		m.log = m.log[len(m.log)-maxLogLines:]
+	}
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.state == detailState {
+			switch {
+			case key.Matches(msg, m.keyMap.Cancel), key.Matches(msg, m.keyMap.Quit):
+				m.detail = nil
+				m.state = listState
+				return m, nil
+			case key.Matches(msg, m.keyMap.ForceQuit):
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.detail.viewport, cmd = m.detail.viewport.Update(msg)
+			return m, cmd
+		}
+
+		if m.state == confirmState {
+			switch {
+			case key.Matches(msg, m.keyMap.Confirm):
+				return m, m.confirmAction()
+			case key.Matches(msg, m.keyMap.Cancel):
+				m.confirm = nil
+				m.state = listState
+			case key.Matches(msg, m.keyMap.ForceQuit):
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+
+		if m.state == reorderState {
+			switch {
+			case key.Matches(msg, m.keyMap.MoveUp):
+				m.reorder.move(-1)
+			case key.Matches(msg, m.keyMap.MoveDown):
+				m.reorder.move(1)
+			case key.Matches(msg, m.keyMap.CursorUp), key.Matches(msg, m.list.KeyMap.CursorUp):
+				m.reorder.cursorUp()
+			case key.Matches(msg, m.keyMap.CursorDown), key.Matches(msg, m.list.KeyMap.CursorDown):
+				m.reorder.cursorDown()
+			case key.Matches(msg, m.keyMap.Confirm):
+				return m, m.confirmReorder()
+			case key.Matches(msg, m.keyMap.Cancel):
+				m.reorder = nil
+				m.state = listState
+			case key.Matches(msg, m.keyMap.ForceQuit):
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+
+		// The list handles every key while the filter is being typed
+		if m.list.SettingFilter() {
+			if key.Matches(msg, m.keyMap.ForceQuit) {
+				return m, tea.Quit
+			}
+			break
+		}
+
 		switch {
 		case key.Matches(msg, m.keyMap.Quit):
+			if m.running != nil {
+				m.appendLog(fmt.Sprintf(
+					"waiting for %s to finish (%s to force quit)",
+					m.running.action.progressive(), m.keyMap.ForceQuit.Help().Key,
+				))
+				return m, nil
+			}
 			return m, tea.Quit
 
 		case key.Matches(msg, m.keyMap.ForceQuit):
 			return m, tea.Quit
 
+		// The cursor keys are handled here so that the list doesn't move the
+		// cursor again if they are also its own cursor keys
 		case key.Matches(msg, m.keyMap.CursorUp):
 			m.list.CursorUp()
+			return m, nil
 
 		case key.Matches(msg, m.keyMap.CursorDown):
 			m.list.CursorDown()
+			return m, nil
+
+		case key.Matches(msg, m.keyMap.Refresh):
+			// Reloading while an action is rewriting the branch could show it
+			// half done
+			if m.running != nil {
+				m.appendLog(fmt.Sprintf("wait for %s to finish before refreshing", m.running.action.progressive()))
+				return m, nil
+			}
+			return m, m.refresh()
+
+		case key.Matches(msg, m.keyMap.Select):
+			return m, m.toggleSelected()
+
+		case key.Matches(msg, m.keyMap.SelectStack):
+			return m, m.selectStack()
+
+		case key.Matches(msg, m.keyMap.Cancel):
+			if len(selectedItems(m.items)) == 0 && m.list.FilterState() == list.FilterApplied {
+				m.list.ResetFilter()
+				return m, nil
+			}
+			return m, m.clearSelection()
+
+		case key.Matches(msg, m.keyMap.OnlyNeedsSync):
+			return m, m.toggleOnly(onlyNeedsSync)
+
+		case key.Matches(msg, m.keyMap.OnlyUnsynced):
+			return m, m.toggleOnly(onlyUnsynced)
+
+		case key.Matches(msg, m.keyMap.OnlyFailing):
+			return m, m.toggleOnly(onlyFailing)
+
+		case key.Matches(msg, m.keyMap.OnlyAwaitingReview):
+			return m, m.toggleOnly(onlyAwaitingReview)
+
+		case key.Matches(msg, m.keyMap.Enter):
+			return m, m.openDetail()
+
+		case key.Matches(msg, m.keyMap.Interdiff):
+			return m, m.openInterdiff()
+
+		case key.Matches(msg, m.keyMap.Sync):
+			return m, m.requestAction(Sync)
 
-		case key.Matches(msg, m.keyMap.Enter), key.Matches(msg, m.keyMap.Sync):
-			m.choice = m.list.SelectedItem()
-			m.action = Sync
-			return m, tea.Quit
 		case key.Matches(msg, m.keyMap.Land):
-			m.choice = m.list.SelectedItem()
-			m.action = Land
-			return m, tea.Quit
+			return m, m.requestAction(Land)
+
+		case key.Matches(msg, m.keyMap.Abandon):
+			return m, m.requestAction(Abandon)
+
+		case key.Matches(msg, m.keyMap.Adopt):
+			return m, m.adopt()
+
+		case key.Matches(msg, m.keyMap.Reorder):
+			return m, m.openReorder()
 		}
 
 	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
 		m.list.SetWidth(msg.Width)
+		if m.detail != nil {
+			m.detail.setSize(msg.Width, msg.Height)
+		}
 		return m, nil
+
+	case detailLoadedMsg:
+		if m.detail != nil && m.detail.item.Commit == msg.commit {
+			m.detail.setContent(m.styles, msg.render, msg.err)
+		}
+		return m, nil
+
+	case itemsLoadedMsg:
+		if msg.generation != m.generation {
+			return m, nil
+		}
+		return m, m.handleItemsLoaded(msg)
+
+	case itemLoadedMsg:
+		if msg.generation != m.generation {
+			return m, nil
+		}
+		return m, m.handleItemLoaded(msg)
+
+	case prStatusesLoadedMsg:
+		if msg.generation != m.generation {
+			return m, nil
+		}
+		return m, m.handlePrStatusesLoaded(msg)
+
+	case autoRefreshMsg:
+		// Skip this refresh if something is already loading or running
+		if m.loading > 0 || m.running != nil {
+			return m, scheduleAutoRefresh(m.refreshInterval)
+		}
+		return m, tea.Batch(
+			m.refresh(),
+			scheduleAutoRefresh(m.refreshInterval),
+		)
+
+	case actionOutputMsg:
+		m.appendLog(msg.line)
+		return m, waitForActionOutput(m.running)
+
+	case actionDoneMsg:
+		return m, m.handleActionDone(msg)
 	}
 
 	var (
@@ -92,15 +721,33 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) View() string {
-	return "\n" + m.list.View()
-}
+	if m.state == confirmState {
+		return "\n" + m.confirm.view(m.styles, m.keyMap)
+	}
+
+	if m.state == detailState {
+		return "\n" + m.detail.view(m.styles, m.keyMap)
+	}
 
-// GetChoice returns the chosen diff ID
-func (m Model) GetChoice() list.Item {
-	return m.choice
+	if m.state == reorderState {
+		return "\n" + m.reorder.view(m.styles, m.keyMap)
+	}
+
+	view := "\n" + m.list.View()
+	if len(m.log) > 0 {
+		view += "\n" + m.logView()
+	}
+	if m.err != nil {
+		view += "\n" + m.styles.StatusFailed.Copy().PaddingLeft(4).Render(fmt.Sprintf("error: %s", m.err))
+	}
+	return view
 }
 
-// GetAction returns the chosen action
-func (m Model) GetAction() DashboardAction {
-	return m.action
+// logView renders the last few lines of action output
+func (m Model) logView() string {
+	lines := m.log
+	if len(lines) > logHeight {
+		lines = lines[len(lines)-logHeight:]
+	}
+	return m.styles.Log.Render(strings.Join(lines, "\n"))
 }